@@ -0,0 +1,139 @@
+package dbal
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// borrowedDB returns a database whose connections are borrowed from db. Closing the returned database returns them
+// to db instead of closing them. This allows closing migrate, which closes the database it has been given, without
+// closing the connection pool of the caller.
+func borrowedDB(db *sql.DB) *sql.DB {
+	return sql.OpenDB(&borrowingConnector{db: db})
+}
+
+type borrowingConnector struct {
+	db *sql.DB
+}
+
+func (c *borrowingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// The driver connection is used after Raw returns, which is safe because conn is not used by anyone else until
+	// the borrowed connection is closed.
+	var dc driver.Conn
+	if err := conn.Raw(func(raw interface{}) error {
+		var ok bool
+		if dc, ok = raw.(driver.Conn); !ok {
+			return errors.Errorf("expected a driver.Conn but got %T", raw)
+		}
+		return nil
+	}); err != nil {
+		_ = conn.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	return &borrowedConn{Conn: dc, owner: conn}, nil
+}
+
+func (c *borrowingConnector) Driver() driver.Driver {
+	return c.db.Driver()
+}
+
+// borrowedConn forwards to a connection of another pool and returns it to that pool when closed. A connection which
+// reported driver.ErrBadConn is discarded instead.
+type borrowedConn struct {
+	driver.Conn
+	owner *sql.Conn
+
+	mtx sync.Mutex
+	bad bool
+}
+
+func (c *borrowedConn) check(err error) error {
+	if err == driver.ErrBadConn {
+		c.mtx.Lock()
+		c.bad = true
+		c.mtx.Unlock()
+	}
+	return err
+}
+
+func (c *borrowedConn) Close() error {
+	c.mtx.Lock()
+	bad := c.bad
+	c.mtx.Unlock()
+
+	if bad {
+		_ = c.owner.Raw(func(interface{}) error {
+			return driver.ErrBadConn
+		})
+	}
+	return errors.WithStack(c.owner.Close())
+}
+
+func (c *borrowedConn) Prepare(query string) (driver.Stmt, error) {
+	s, err := c.Conn.Prepare(query)
+	return s, c.check(err)
+}
+
+func (c *borrowedConn) Begin() (driver.Tx, error) {
+	tx, err := c.Conn.Begin()
+	return tx, c.check(err)
+}
+
+func (c *borrowedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err := b.BeginTx(ctx, opts)
+		return tx, c.check(err)
+	}
+	if opts.Isolation != 0 || opts.ReadOnly {
+		return nil, errors.New("driver does not support non-default isolation levels or read-only transactions")
+	}
+	return c.Begin()
+}
+
+func (c *borrowedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		s, err := p.PrepareContext(ctx, query)
+		return s, c.check(err)
+	}
+	return c.Prepare(query)
+}
+
+func (c *borrowedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		r, err := e.ExecContext(ctx, query, args)
+		return r, c.check(err)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *borrowedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		r, err := q.QueryContext(ctx, query, args)
+		return r, c.check(err)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *borrowedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return c.check(p.Ping(ctx))
+	}
+	return nil
+}
+
+func (c *borrowedConn) CheckNamedValue(v *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
@@ -2,12 +2,16 @@ package dbal
 
 import (
 	"errors"
+	"net/url"
+	"sort"
 	"sync"
 )
 
 var (
-	drivers = make([]Driver, 0)
-	dmtx    sync.Mutex
+	drivers   = make([]Driver, 0)
+	factories = make(map[string]DriverFactory)
+	instances = make(map[string]Driver)
+	dmtx      sync.RWMutex
 
 	// ErrNoResponsibleDriverFound is returned when no driver was found for the provided DSN.
 	ErrNoResponsibleDriverFound = errors.New("no driver is capable of handling the given DSN")
@@ -22,6 +26,10 @@ type Driver interface {
 	Ping() error
 }
 
+// DriverFactory creates a driver for the given DSN. The DSN's scheme is one of the schemes the factory has been
+// registered for. Factories are called while GetDriverFor holds its lock, so they must not call GetDriverFor.
+type DriverFactory func(dsn string) (Driver, error)
+
 // RegisterDriver registers a driver
 func RegisterDriver(d Driver) {
 	dmtx.Lock()
@@ -29,12 +37,87 @@ func RegisterDriver(d Driver) {
 	dmtx.Unlock()
 }
 
+// RegisterDriverFactory registers a factory which creates drivers for DSNs with the given scheme, e.g. postgres.
+// Registering a factory for a scheme again replaces the previous one and forgets the drivers it has created, they are
+// not closed. The packages in the subdirectories of dbal register their factories when they are imported, e.g.
+//
+//	import _ "github.com/open-identity/utils/dbal/postgres"
+//
+// These factories create SQL drivers without a logger. To receive the log messages of the connection pools, replace
+// them before the first call to GetDriverFor:
+//
+//	dbal.RegisterDriverFactory("postgres", dbal.NewSQLDriverFactory(logger))
+func RegisterDriverFactory(scheme string, f DriverFactory) {
+	dmtx.Lock()
+	defer dmtx.Unlock()
+
+	factories[scheme] = f
+	for dsn := range instances {
+		if u, err := url.Parse(dsn); err == nil && u.Scheme == scheme {
+			delete(instances, dsn)
+		}
+	}
+}
+
+// SupportedSchemes returns the sorted DSN schemes for which a driver factory has been registered.
+func SupportedSchemes() []string {
+	dmtx.RLock()
+	defer dmtx.RUnlock()
+
+	schemes := make([]string, 0, len(factories))
+	for scheme := range factories {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
 // GetDriverFor returns a driver for the given DSN or ErrNoResponsibleDriverFound if no driver was found.
+//
+// Drivers registered using RegisterDriver are asked first. Otherwise a driver is created by the factory registered
+// for the DSN's scheme, see RegisterDriverFactory, so a binary can choose its storage backend based on its
+// configuration. The created driver is cached and returned for all subsequent calls with the same DSN, so calling
+// GetDriverFor repeatedly, e.g. from a readiness probe, does not open a new connection pool each time. Cached drivers
+// live as long as the process and must not be closed by callers.
 func GetDriverFor(dsn string) (Driver, error) {
+	dmtx.RLock()
+	d, ok := findDriver(dsn)
+	dmtx.RUnlock()
+	if ok {
+		return d, nil
+	}
+
+	dmtx.Lock()
+	defer dmtx.Unlock()
+
+	// Another caller may have created the driver in the meantime.
+	if d, ok := findDriver(dsn); ok {
+		return d, nil
+	}
+
+	var factory DriverFactory
+	if u, err := url.Parse(dsn); err == nil {
+		factory = factories[u.Scheme]
+	}
+	if factory == nil {
+		return nil, ErrNoResponsibleDriverFound
+	}
+
+	d, err := factory(dsn)
+	if err != nil {
+		return nil, err
+	}
+	instances[dsn] = d
+	return d, nil
+}
+
+// findDriver returns the registered or cached driver for the DSN. dmtx must be held.
+func findDriver(dsn string) (Driver, bool) {
 	for _, d := range drivers {
 		if d.CanHandle(dsn) {
-			return d, nil
+			return d, true
 		}
 	}
-	return nil, ErrNoResponsibleDriverFound
+	d, ok := instances[dsn]
+	return d, ok
 }
@@ -0,0 +1,99 @@
+package dbal
+
+import (
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DriverMemory is the DSN scheme of the in-memory driver, e.g. memory://foo.
+const DriverMemory = "memory"
+
+var (
+	memoryDrivers    = make(map[string]*MemoryDriver)
+	memoryDriversMtx sync.Mutex
+)
+
+func init() {
+	RegisterDriverFactory(DriverMemory, func(dsn string) (Driver, error) {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return NewMemoryDriver(u.Host), nil
+	})
+}
+
+// MemoryDriver is an in-memory driver for tests and local development. It is registered for memory DSNs, so
+// GetDriverFor("memory://foo") returns the driver named foo. Ping always succeeds unless a failure has been injected
+// using SetPingError or SetPingLatency.
+type MemoryDriver struct {
+	name string
+
+	mtx     sync.Mutex
+	pingErr error
+	latency time.Duration
+	pings   int
+}
+
+var _ Driver = (*MemoryDriver)(nil)
+
+// NewMemoryDriver returns the in-memory driver with the given name, creating it if necessary. All callers, including
+// GetDriverFor, share the driver of a name, so tests can inject failures into the driver used by the code under
+// test.
+func NewMemoryDriver(name string) *MemoryDriver {
+	memoryDriversMtx.Lock()
+	defer memoryDriversMtx.Unlock()
+
+	d, ok := memoryDrivers[name]
+	if !ok {
+		d = &MemoryDriver{name: name}
+		memoryDrivers[name] = d
+	}
+	return d
+}
+
+// CanHandle returns true for memory DSNs with the name of the driver.
+func (d *MemoryDriver) CanHandle(dsn string) bool {
+	u, err := url.Parse(dsn)
+	return err == nil && u.Scheme == DriverMemory && u.Host == d.name
+}
+
+// Ping waits for the injected latency and returns the injected error, if any.
+func (d *MemoryDriver) Ping() error {
+	d.mtx.Lock()
+	d.pings++
+	latency, err := d.latency, d.pingErr
+	d.mtx.Unlock()
+
+	time.Sleep(latency)
+	return err
+}
+
+// SetPingError makes Ping return err. Pass nil to make it succeed again.
+func (d *MemoryDriver) SetPingError(err error) {
+	d.mtx.Lock()
+	d.pingErr = err
+	d.mtx.Unlock()
+}
+
+// SetPingLatency makes Ping wait for the given duration.
+func (d *MemoryDriver) SetPingLatency(latency time.Duration) {
+	d.mtx.Lock()
+	d.latency = latency
+	d.mtx.Unlock()
+}
+
+// Pings returns how often Ping has been called.
+func (d *MemoryDriver) Pings() int {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.pings
+}
+
+// Reset removes all injected failures and resets the number of pings.
+func (d *MemoryDriver) Reset() {
+	d.mtx.Lock()
+	d.pingErr, d.latency, d.pings = nil, 0, 0
+	d.mtx.Unlock()
+}
@@ -0,0 +1,41 @@
+package dbal_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/open-identity/utils/dbal"
+)
+
+func TestMemoryDriver(t *testing.T) {
+	assert.Contains(t, dbal.SupportedSchemes(), dbal.DriverMemory)
+
+	d, err := dbal.GetDriverFor("memory://foo")
+	require.NoError(t, err)
+	require.IsType(t, &dbal.MemoryDriver{}, d)
+	assert.True(t, d.CanHandle("memory://foo"))
+	assert.False(t, d.CanHandle("memory://bar"))
+	require.NoError(t, d.Ping())
+
+	m := dbal.NewMemoryDriver("foo")
+	defer m.Reset()
+	assert.Equal(t, d, m, "drivers with the same name are shared")
+
+	m.SetPingError(errors.New("connection refused"))
+	assert.EqualError(t, d.Ping(), "connection refused")
+
+	other, err := dbal.GetDriverFor("memory://bar")
+	require.NoError(t, err)
+	require.NoError(t, other.Ping())
+
+	m.SetPingError(nil)
+	m.SetPingLatency(time.Millisecond * 20)
+	start := time.Now()
+	require.NoError(t, d.Ping())
+	assert.True(t, time.Since(start) >= time.Millisecond*20)
+	assert.Equal(t, 3, m.Pings())
+}
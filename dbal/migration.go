@@ -7,10 +7,28 @@ import (
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database"
 	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/jmoiron/sqlx"
 	vfsdata "github.com/neermitt/migrate-vfsdata-source"
-	"github.com/sirupsen/logrus"
+	"github.com/pkg/errors"
 )
 
+// ErrDownNotConfirmed is returned by MigrateDown unless WithDownConfirmed is passed.
+var ErrDownNotConfirmed = errors.New("rolling back all migrations requires an explicit confirmation")
+
+type migrateOptions struct {
+	downConfirmed bool
+}
+
+// MigrateOption is a wrapper for the options of MigrateDown.
+type MigrateOption func(*migrateOptions)
+
+// WithDownConfirmed confirms that MigrateDown may roll back all migrations.
+func WithDownConfirmed() MigrateOption {
+	return func(o *migrateOptions) {
+		o.downConfirmed = true
+	}
+}
+
 type MigrationDriverFactory func(db DBDriver, migrationTable string) (database.Driver, error)
 
 var (
@@ -22,49 +40,120 @@ type DBDriver interface {
 	DriverName() string
 }
 
-func MigrationSourceDriver(fs http.FileSystem, path string) source.Driver {
+// MigrationSourceDriver returns a source driver which reads the migrations from the given path of fs.
+func MigrationSourceDriver(fs http.FileSystem, path string) (source.Driver, error) {
 	driver, err := vfsdata.WithInstance(vfsdata.Resource(path, fs))
 	if err != nil {
-		logrus.WithError(err).Fatalf("Failed to create source driver for migrations")
-		panic(err)
+		return nil, errors.Wrapf(err, "unable to create source driver for migrations in %s", path)
 	}
-	return driver
+	return driver, nil
 }
 
+// ToMigrate returns a migrate instance for the given source and database. If db is a *sqlx.DB, migrate borrows its
+// connections from db, so closing the returned instance returns them instead of closing db. The instance holds on
+// to one connection until it is closed, close it once done. Closing it closes sourceDriver as well.
 func ToMigrate(sourceDriver source.Driver, db DBDriver, migrationTable string) (*migrate.Migrate, error) {
-	var dbDriver database.Driver
-
-	if dbDriverFactory, err := GetMigrationDriverFactoryFor(db.DriverName()); err != nil {
+	dbDriverFactory, err := GetMigrationDriverFactoryFor(db.DriverName())
+	if err != nil {
 		return nil, err
-	} else {
-		dbDriver, _ = dbDriverFactory(db, migrationTable)
 	}
 
-	return migrate.NewWithInstance("source", sourceDriver, db.DriverName(), dbDriver)
-}
+	var borrowed *sqlx.DB
+	if sqlxDB, ok := db.(*sqlx.DB); ok {
+		borrowed = sqlx.NewDb(borrowedDB(sqlxDB.DB), sqlxDB.DriverName())
+		db = borrowed
+	}
 
-func MigrateUp(sourceDriver source.Driver, db DBDriver, migrationTable string) (int, error) {
-	mig, err := ToMigrate(sourceDriver, db, migrationTable)
+	dbDriver, err := dbDriverFactory(db, migrationTable)
 	if err != nil {
-		return 0, err
+		if borrowed != nil {
+			_ = borrowed.Close()
+		}
+		return nil, errors.Wrapf(err, "unable to create %s migration driver for table %s", db.DriverName(), migrationTable)
 	}
 
-	err = mig.Up()
-	version, _, _ := mig.Version()
+	mig, err := migrate.NewWithInstance("source", sourceDriver, db.DriverName(), dbDriver)
 	if err != nil {
-		return int(version), err
+		if borrowed != nil {
+			_ = dbDriver.Close()
+		}
+		return nil, errors.WithStack(err)
 	}
-	return int(version), nil
-
+	return mig, nil
 }
 
-func MigrateDown(sourceDriver source.Driver, db DBDriver, migrationTable string) error {
-	mig, err := ToMigrate(sourceDriver, db, migrationTable)
+// withMigrate calls fn with a migrate instance and closes it afterwards, keeping sourceDriver open.
+func withMigrate(sourceDriver source.Driver, db DBDriver, migrationTable string, fn func(*migrate.Migrate) error) error {
+	mig, err := ToMigrate(unclosableSource{Driver: sourceDriver}, db, migrationTable)
 	if err != nil {
 		return err
 	}
+	defer mig.Close()
+
+	return fn(mig)
+}
+
+// unclosableSource prevents migrate from closing a source driver which is owned by the caller.
+type unclosableSource struct {
+	source.Driver
+}
+
+func (unclosableSource) Close() error {
+	return nil
+}
+
+func MigrateUp(sourceDriver source.Driver, db DBDriver, migrationTable string) (version int, err error) {
+	err = withMigrate(sourceDriver, db, migrationTable, func(mig *migrate.Migrate) error {
+		err := mig.Up()
+		v, _, _ := mig.Version()
+		version = int(v)
+		return err
+	})
+	return version, err
+}
+
+// MigrateDown rolls back all migrations. Because this drops the whole schema, it fails with ErrDownNotConfirmed
+// unless WithDownConfirmed is passed. Use MigrateTo or MigrateSteps to roll back individual migrations.
+func MigrateDown(sourceDriver source.Driver, db DBDriver, migrationTable string, opts ...MigrateOption) error {
+	o := &migrateOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if !o.downConfirmed {
+		return ErrDownNotConfirmed
+	}
+
+	return withMigrate(sourceDriver, db, migrationTable, func(mig *migrate.Migrate) error {
+		return mig.Down()
+	})
+}
 
-	return mig.Down()
+// MigrateTo applies or rolls back migrations until the given version is reached.
+func MigrateTo(sourceDriver source.Driver, db DBDriver, migrationTable string, version uint) error {
+	return withMigrate(sourceDriver, db, migrationTable, func(mig *migrate.Migrate) error {
+		return mig.Migrate(version)
+	})
+}
+
+// MigrateSteps applies the next n migrations if n is positive or rolls back the last -n migrations if n is negative
+// and returns the resulting version.
+func MigrateSteps(sourceDriver source.Driver, db DBDriver, migrationTable string, n int) (version int, err error) {
+	err = withMigrate(sourceDriver, db, migrationTable, func(mig *migrate.Migrate) error {
+		err := mig.Steps(n)
+		v, _, _ := mig.Version()
+		version = int(v)
+		return err
+	})
+	return version, err
+}
+
+// ForceVersion sets the version of the database without running any migrations and clears the dirty flag. Use it
+// to recover from a failed migration after fixing the schema manually. A version of -1 marks the database as not
+// migrated at all.
+func ForceVersion(sourceDriver source.Driver, db DBDriver, migrationTable string, version int) error {
+	return withMigrate(sourceDriver, db, migrationTable, func(mig *migrate.Migrate) error {
+		return mig.Force(version)
+	})
 }
 
 // RegisterDriver registers a driver
@@ -76,7 +165,11 @@ func RegisterMigrationDriverFactory(driverName string, d MigrationDriverFactory)
 
 // GetDriverFor returns a driver for the given DSN or ErrNoResponsibleDriverFound if no driver was found.
 func GetMigrationDriverFactoryFor(driverName string) (MigrationDriverFactory, error) {
-	if factory, hasDriver := migrationDriverFactories[driverName]; hasDriver {
+	mdfmtx.Lock()
+	factory, hasDriver := migrationDriverFactories[driverName]
+	mdfmtx.Unlock()
+
+	if hasDriver {
 		return factory, nil
 	}
 	return nil, ErrNoResponsibleDriverFound
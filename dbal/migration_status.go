@@ -0,0 +1,155 @@
+package dbal
+
+import (
+	"database/sql"
+	"os"
+	"sort"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/open-identity/utils/sqlcon"
+)
+
+// MigrationStatus is the state of a single migration.
+type MigrationStatus struct {
+	// Version is the version of the migration, e.g. 1 for 1_foo.up.sql.
+	Version uint `json:"version"`
+
+	// Name is the identifier of the migration, e.g. foo for 1_foo.up.sql. It is empty if the migration has been
+	// applied but does not exist in the source.
+	Name string `json:"name"`
+
+	// Applied is true if the migration has been applied successfully.
+	Applied bool `json:"applied"`
+
+	// Dirty is true if applying the migration failed half way through. The schema needs to be fixed manually before
+	// the version can be forced and migrations can be run again.
+	Dirty bool `json:"dirty"`
+}
+
+// MigrationStatuses is the state of all migrations, ordered by version.
+type MigrationStatuses []MigrationStatus
+
+// Pending returns the migrations which have not been applied yet, excluding a dirty one.
+func (s MigrationStatuses) Pending() MigrationStatuses {
+	var pending MigrationStatuses
+	for _, m := range s {
+		if !m.Applied && !m.Dirty {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+// IsDirty returns true if a migration failed half way through.
+func (s MigrationStatuses) IsDirty() bool {
+	for _, m := range s {
+		if m.Dirty {
+			return true
+		}
+	}
+	return false
+}
+
+// MigrationVersion returns the version of the last applied migration and whether it is dirty. It returns
+// migrate.ErrNilVersion if no migration has been applied yet. The migration table is read directly, so unlike
+// running migrations, it is neither created nor locked. db must be a *sqlx.DB or *sqlx.Tx.
+func MigrationVersion(db DBDriver, migrationTable string) (uint, bool, error) {
+	q, ok := db.(sqlx.Ext)
+	if !ok {
+		return 0, false, errors.Errorf("unable to read the migration version using %T", db)
+	}
+
+	var exists, read string
+	switch db.DriverName() {
+	case sqlcon.DriverPostgreSQL:
+		exists = "SELECT COUNT(1) FROM information_schema.tables WHERE table_name = ? AND table_schema = (SELECT current_schema())"
+		read = `SELECT version, dirty FROM "` + migrationTable + `" LIMIT 1`
+	case sqlcon.DriverMySQL:
+		exists = "SELECT COUNT(1) FROM information_schema.tables WHERE table_name = ? AND table_schema = (SELECT DATABASE())"
+		read = "SELECT version, dirty FROM `" + migrationTable + "` LIMIT 1"
+	case sqlcon.DriverSQLite:
+		exists = "SELECT COUNT(1) FROM sqlite_master WHERE type = 'table' AND name = ?"
+		read = "SELECT version, dirty FROM " + migrationTable + " LIMIT 1"
+	default:
+		return 0, false, errors.Errorf("unable to read the migration version of %s", db.DriverName())
+	}
+
+	var tables int
+	if err := q.QueryRowx(q.Rebind(exists), migrationTable).Scan(&tables); err != nil {
+		return 0, false, errors.WithStack(err)
+	}
+	if tables == 0 {
+		return 0, false, migrate.ErrNilVersion
+	}
+
+	var version int64
+	var dirty bool
+	if err := q.QueryRowx(read).Scan(&version, &dirty); err == sql.ErrNoRows {
+		return 0, false, migrate.ErrNilVersion
+	} else if err != nil {
+		return 0, false, errors.WithStack(err)
+	}
+	if version < 0 {
+		return 0, false, migrate.ErrNilVersion
+	}
+	return uint(version), dirty, nil
+}
+
+// GetMigrationStatus lists all migrations of the source together with their state in the database. A migration counts
+// as applied if its version is lower than or equal to the current version of the database.
+func GetMigrationStatus(sourceDriver source.Driver, db DBDriver, migrationTable string) (MigrationStatuses, error) {
+	current, dirty, err := MigrationVersion(db, migrationTable)
+	applied := true
+	if err == migrate.ErrNilVersion {
+		applied = false
+	} else if err != nil {
+		return nil, err
+	}
+
+	var statuses MigrationStatuses
+	var found bool
+	version, err := sourceDriver.First()
+	for err == nil {
+		name, nameErr := migrationName(sourceDriver, version)
+		if nameErr != nil {
+			return nil, nameErr
+		}
+
+		status := MigrationStatus{Version: version, Name: name}
+		if applied && version <= current {
+			status.Dirty = version == current && dirty
+			status.Applied = !status.Dirty
+			found = found || version == current
+		}
+		statuses = append(statuses, status)
+
+		version, err = sourceDriver.Next(version)
+	}
+	if !os.IsNotExist(errors.Cause(err)) {
+		return nil, errors.WithStack(err)
+	}
+
+	if applied && !found {
+		// The database is at a version which is unknown to the source, e.g. after a rollback of the code.
+		statuses = append(statuses, MigrationStatus{Version: current, Applied: !dirty, Dirty: dirty})
+		sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	}
+	return statuses, nil
+}
+
+// migrationName returns the identifier of the migration with the given version.
+func migrationName(sourceDriver source.Driver, version uint) (string, error) {
+	r, name, err := sourceDriver.ReadUp(version)
+	if os.IsNotExist(errors.Cause(err)) {
+		r, name, err = sourceDriver.ReadDown(version)
+	}
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	_ = r.Close()
+	return name, nil
+}
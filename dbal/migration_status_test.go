@@ -0,0 +1,69 @@
+package dbal_test
+
+import (
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/open-identity/utils/dbal"
+	_ "github.com/open-identity/utils/dbal/sqlite"
+	"github.com/open-identity/utils/sqlcon"
+)
+
+func TestGetMigrationStatus(t *testing.T) {
+	c, err := sqlcon.NewSQLConnection("sqlite://:memory:", nil)
+	require.NoError(t, err)
+	db, err := c.GetDatabase()
+	require.NoError(t, err)
+
+	_, _, err = dbal.MigrationVersion(db, "schema_migrations")
+	assert.Equal(t, migrate.ErrNilVersion, err)
+
+	statuses, err := dbal.GetMigrationStatus(testSource(t), db, "schema_migrations")
+	require.NoError(t, err)
+	assert.Equal(t, dbal.MigrationStatuses{
+		{Version: 1, Name: "foo"},
+		{Version: 2, Name: "bar"},
+	}, statuses)
+	assert.Len(t, statuses.Pending(), 2)
+
+	_, err = db.Exec("SELECT COUNT(*) FROM schema_migrations")
+	require.Error(t, err, "inspecting the status must not create the migration table")
+	assert.Equal(t, 0, db.Stats().InUse)
+
+	_, err = db.Exec("CREATE TABLE schema_migrations (version uint64, dirty bool)")
+	require.NoError(t, err)
+	_, _, err = dbal.MigrationVersion(db, "schema_migrations")
+	assert.Equal(t, migrate.ErrNilVersion, err)
+
+	_, err = db.Exec("INSERT INTO schema_migrations (version, dirty) VALUES (2, 1)")
+	require.NoError(t, err)
+
+	statuses, err = dbal.GetMigrationStatus(testSource(t), db, "schema_migrations")
+	require.NoError(t, err)
+	assert.Equal(t, dbal.MigrationStatuses{
+		{Version: 1, Name: "foo", Applied: true},
+		{Version: 2, Name: "bar", Dirty: true},
+	}, statuses)
+	assert.True(t, statuses.IsDirty())
+	assert.Empty(t, statuses.Pending())
+
+	_, err = db.Exec("UPDATE schema_migrations SET version = 3, dirty = 0")
+	require.NoError(t, err)
+
+	version, dirty, err := dbal.MigrationVersion(db, "schema_migrations")
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, version)
+	assert.False(t, dirty)
+
+	statuses, err = dbal.GetMigrationStatus(testSource(t), db, "schema_migrations")
+	require.NoError(t, err)
+	assert.Equal(t, dbal.MigrationStatuses{
+		{Version: 1, Name: "foo", Applied: true},
+		{Version: 2, Name: "bar", Applied: true},
+		{Version: 3, Applied: true},
+	}, statuses)
+	assert.Equal(t, 0, db.Stats().InUse)
+}
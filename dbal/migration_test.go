@@ -0,0 +1,143 @@
+package dbal_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/open-identity/utils/dbal"
+	_ "github.com/open-identity/utils/dbal/sqlite"
+	"github.com/open-identity/utils/sqlcon"
+)
+
+func testSource(t *testing.T) source.Driver {
+	src, err := dbal.MigrationSourceDriver(http.Dir("."), "testdata")
+	require.NoError(t, err)
+	return src
+}
+
+type failingDBDriver struct{}
+
+func (d failingDBDriver) DriverName() string {
+	return "failing"
+}
+
+func TestMigrationErrors(t *testing.T) {
+	_, err := dbal.MigrationSourceDriver(http.Dir("."), "does-not-exist")
+	require.Error(t, err)
+
+	dbal.RegisterMigrationDriverFactory("failing", func(db dbal.DBDriver, migrationTable string) (database.Driver, error) {
+		return nil, errors.New("connection refused")
+	})
+	_, err = dbal.ToMigrate(testSource(t), failingDBDriver{}, "schema_migrations")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to create failing migration driver for table schema_migrations")
+	assert.Contains(t, err.Error(), "connection refused")
+}
+
+func TestMigrateSQLite(t *testing.T) {
+	c, err := sqlcon.NewSQLConnection("sqlite://:memory:", nil)
+	require.NoError(t, err)
+	db, err := c.GetDatabase()
+	require.NoError(t, err)
+
+	version, err := dbal.MigrateUp(testSource(t), db, "schema_migrations")
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	_, err = db.Exec("INSERT INTO foo (name) VALUES (?)", "baz")
+	require.NoError(t, err)
+
+	assert.Equal(t, dbal.ErrDownNotConfirmed, dbal.MigrateDown(testSource(t), db, "schema_migrations"))
+	require.NoError(t, dbal.MigrateDown(testSource(t), db, "schema_migrations", dbal.WithDownConfirmed()))
+	_, err = db.Exec("INSERT INTO foo (name) VALUES (?)", "baz")
+	require.Error(t, err)
+	assert.Equal(t, 0, db.Stats().InUse, "migrations must release their connections")
+}
+
+func TestMigrateTargeted(t *testing.T) {
+	c, err := sqlcon.NewSQLConnection("sqlite://:memory:", nil)
+	require.NoError(t, err)
+	db, err := c.GetDatabase()
+	require.NoError(t, err)
+
+	version := func() uint {
+		v, dirty, err := dbal.MigrationVersion(db, "schema_migrations")
+		require.NoError(t, err)
+		assert.False(t, dirty)
+		return v
+	}
+
+	require.NoError(t, dbal.MigrateTo(testSource(t), db, "schema_migrations", 1))
+	assert.EqualValues(t, 1, version())
+
+	v, err := dbal.MigrateSteps(testSource(t), db, "schema_migrations", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, v)
+
+	v, err = dbal.MigrateSteps(testSource(t), db, "schema_migrations", -1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+
+	require.NoError(t, dbal.ForceVersion(testSource(t), db, "schema_migrations", 2))
+	assert.EqualValues(t, 2, version())
+	require.NoError(t, dbal.ForceVersion(testSource(t), db, "schema_migrations", 1))
+
+	require.NoError(t, dbal.MigrateTo(testSource(t), db, "schema_migrations", 2))
+	assert.EqualValues(t, 2, version())
+	assert.Equal(t, 0, db.Stats().InUse, "migrations must release their connections")
+}
+
+// heldConnDriver holds on to a connection until it is closed and closes the database afterwards, like the migrate
+// drivers for PostgreSQL and MySQL.
+type heldConnDriver struct {
+	database.Driver
+	conn *sql.Conn
+}
+
+func (d *heldConnDriver) Close() error {
+	_ = d.conn.Close()
+	return d.Driver.Close()
+}
+
+func TestMigrationsReleaseConnections(t *testing.T) {
+	dbal.RegisterMigrationDriverFactory("held", func(db dbal.DBDriver, migrationTable string) (database.Driver, error) {
+		instance := db.(*sqlx.DB).DB
+		conn, err := instance.Conn(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		d, err := sqlite3.WithInstance(instance, &sqlite3.Config{MigrationsTable: migrationTable})
+		if err != nil {
+			return nil, err
+		}
+		return &heldConnDriver{Driver: d, conn: conn}, nil
+	})
+
+	c, err := sqlcon.NewSQLConnection("sqlite://:memory:", nil)
+	require.NoError(t, err)
+	pool, err := c.GetDatabase()
+	require.NoError(t, err)
+	db := sqlx.NewDb(pool.DB, "held")
+
+	for i := 0; i < 3; i++ {
+		_, err = dbal.MigrateUp(testSource(t), db, "schema_migrations")
+		require.NoError(t, err)
+		require.NoError(t, dbal.MigrateTo(testSource(t), db, "schema_migrations", 1))
+		_, err = dbal.MigrateSteps(testSource(t), db, "schema_migrations", -1)
+		require.NoError(t, err)
+		require.NoError(t, dbal.ForceVersion(testSource(t), db, "schema_migrations", -1))
+	}
+
+	assert.Equal(t, 0, pool.Stats().InUse)
+	require.NoError(t, pool.Ping(), "the pool of the caller must not be closed")
+}
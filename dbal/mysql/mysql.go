@@ -0,0 +1,23 @@
+package mysql
+
+import (
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/open-identity/utils/dbal"
+)
+
+const (
+	DriverMySQL = "mysql"
+)
+
+// Migrations containing more than one statement require the DSN to set multiStatements=true.
+func init() {
+	dbal.RegisterDriverFactory(DriverMySQL, dbal.NewSQLDriverFactory(nil))
+
+	dbal.RegisterMigrationDriverFactory(DriverMySQL, func(db dbal.DBDriver, migrationTable string) (database.Driver, error) {
+		return mysql.WithInstance(db.(*sqlx.DB).DB, &mysql.Config{
+			MigrationsTable: migrationTable,
+		})
+	})
+}
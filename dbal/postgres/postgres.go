@@ -12,6 +12,8 @@ const (
 )
 
 func init() {
+	dbal.RegisterDriverFactory(DriverPostgresSQL, dbal.NewSQLDriverFactory(nil))
+
 	dbal.RegisterMigrationDriverFactory(DriverPostgresSQL, func(db dbal.DBDriver, migrationTable string) (database.Driver, error) {
 		return postgres.WithInstance(db.(*sqlx.DB).DB, &postgres.Config{
 			MigrationsTable: migrationTable,
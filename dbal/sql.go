@@ -0,0 +1,51 @@
+package dbal
+
+import (
+	"net/url"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/open-identity/utils/sqlcon"
+)
+
+// SQLDriver is a Driver backed by a SQL database. It embeds the sqlcon.SQLConnection the persistence layer uses to
+// run its queries. The connection pool is opened lazily.
+type SQLDriver struct {
+	*sqlcon.SQLConnection
+}
+
+var _ Driver = (*SQLDriver)(nil)
+
+// NewSQLDriver returns a SQLDriver for the given DSN, see sqlcon.NewSQLConnection.
+func NewSQLDriver(dsn string, l logrus.FieldLogger, opts ...sqlcon.OptionModifier) (*SQLDriver, error) {
+	c, err := sqlcon.NewSQLConnection(dsn, l, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLDriver{SQLConnection: c}, nil
+}
+
+// NewSQLDriverFactory returns a DriverFactory which creates a SQLDriver using the given logger and options. Register
+// it to replace the factories of the dbal subpackages, which do not log, see RegisterDriverFactory.
+func NewSQLDriverFactory(l logrus.FieldLogger, opts ...sqlcon.OptionModifier) DriverFactory {
+	return func(dsn string) (Driver, error) {
+		return NewSQLDriver(dsn, l, opts...)
+	}
+}
+
+// CanHandle returns true if the DSN equals the DSN of the driver. DSNs which differ in the host, the database, the
+// credentials or the options need a connection pool of their own.
+func (d *SQLDriver) CanHandle(dsn string) bool {
+	u, err := url.Parse(dsn)
+	return err == nil && u.String() == d.URL.String()
+}
+
+// Ping opens the connection pool, if necessary, and pings the database.
+func (d *SQLDriver) Ping() error {
+	db, err := d.GetDatabase()
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(db.Ping())
+}
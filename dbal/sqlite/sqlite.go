@@ -0,0 +1,23 @@
+package sqlite
+
+import (
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/jmoiron/sqlx"
+	"github.com/open-identity/utils/dbal"
+	_ "github.com/open-identity/utils/sqlcon/sqlite"
+)
+
+const (
+	DriverSQLite = "sqlite"
+)
+
+func init() {
+	dbal.RegisterDriverFactory(DriverSQLite, dbal.NewSQLDriverFactory(nil))
+
+	dbal.RegisterMigrationDriverFactory(DriverSQLite, func(db dbal.DBDriver, migrationTable string) (database.Driver, error) {
+		return sqlite3.WithInstance(db.(*sqlx.DB).DB, &sqlite3.Config{
+			MigrationsTable: migrationTable,
+		})
+	})
+}
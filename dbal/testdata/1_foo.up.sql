@@ -0,0 +1 @@
+CREATE TABLE foo (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
@@ -0,0 +1 @@
+CREATE TABLE bar (id INTEGER PRIMARY KEY);
@@ -1,6 +1,6 @@
 module github.com/open-identity/utils
 
-go 1.12
+go 1.15
 
 require (
 	github.com/InVisionApp/go-health v2.1.0+incompatible
@@ -8,10 +8,12 @@ require (
 	github.com/bmizerany/assert v0.0.0-20160611221934-b7ed37b82869
 	github.com/cenkalti/backoff v2.1.1+incompatible
 	github.com/codahale/hdrhistogram v0.0.0-20161010025455-3a0bb77429bd // indirect
+	github.com/go-sql-driver/mysql v1.4.1
 	github.com/golang-migrate/migrate/v4 v4.3.1
 	github.com/jmoiron/sqlx v1.2.0
 	github.com/lib/pq v1.0.0
 	github.com/luna-duclos/instrumentedsql v0.0.0-20190316074304-ecad98b20aec
+	github.com/mattn/go-sqlite3 v1.10.0
 	github.com/neermitt/migrate-vfsdata-source v0.0.0-20190415170452-7c6d1170aa29
 	github.com/onsi/ginkgo v1.8.0 // indirect
 	github.com/onsi/gomega v1.5.0 // indirect
@@ -10,7 +10,8 @@ const (
 	ViperKeyLogFormat = "log.format"
 )
 
-// New initializes logrus with environment variable configuration LOG_LEVEL and LOG_FORMAT.
+// New initializes logrus with environment variable configuration LOG_LEVEL and LOG_FORMAT. Secrets of DSNs
+// contained in log entries are redacted, see NewRedactionHook.
 func New() *logrus.Logger {
 	l := logrus.New()
 	ll, err := logrus.ParseLevel(viper.GetString(ViperKeyLogLevel))
@@ -23,5 +24,7 @@ func New() *logrus.Logger {
 		l.Formatter = new(logrus.JSONFormatter)
 	}
 
+	l.Hooks.Add(NewRedactionHook(nil))
+
 	return l
 }
@@ -0,0 +1,72 @@
+package logrusx
+
+import (
+	"github.com/open-identity/utils/dsnx"
+	"github.com/sirupsen/logrus"
+)
+
+type redactionHook struct {
+	r *dsnx.Redactor
+}
+
+// NewRedactionHook returns a hook which masks the secrets of all DSNs contained in the message and the string and
+// error fields of log entries. If r is nil, dsnx.DefaultSensitiveParameters are redacted.
+func NewRedactionHook(r *dsnx.Redactor) logrus.Hook {
+	if r == nil {
+		r = dsnx.NewRedactor()
+	}
+	return &redactionHook{r: r}
+}
+
+func (h *redactionHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *redactionHook) Fire(entry *logrus.Entry) error {
+	entry.Message = h.r.RedactString(entry.Message)
+
+	// The map is copied because it may be shared with other entries.
+	data := make(logrus.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		switch t := v.(type) {
+		case string:
+			data[k] = h.r.RedactString(t)
+		case error:
+			data[k] = h.redactError(t)
+		default:
+			data[k] = v
+		}
+	}
+	entry.Data = data
+	return nil
+}
+
+// redactError returns err if it does not contain DSNs. Otherwise the error is wrapped, so that it remains an error for
+// formatters and hooks running later while its message is redacted.
+func (h *redactionHook) redactError(err error) error {
+	message := err.Error()
+	redacted := h.r.RedactString(message)
+	if redacted == message {
+		return err
+	}
+	return &redactedError{message: redacted, cause: err}
+}
+
+type redactedError struct {
+	message string
+	cause   error
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+// Cause returns the original error, see github.com/pkg/errors.Cause.
+func (e *redactedError) Cause() error {
+	return e.cause
+}
+
+// Unwrap returns the original error, see errors.Unwrap.
+func (e *redactedError) Unwrap() error {
+	return e.cause
+}
@@ -0,0 +1,417 @@
+package sqlcon
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const (
+	// MaxParametersPostgreSQL is the maximum number of parameters of a PostgreSQL statement.
+	MaxParametersPostgreSQL = 65535
+	// MaxParametersMySQL is the maximum number of placeholders of a MySQL prepared statement.
+	MaxParametersMySQL = 65535
+	// MaxParametersSQLite is the default maximum number of parameters of a SQLite statement
+	// (SQLITE_MAX_VARIABLE_NUMBER).
+	MaxParametersSQLite = 999
+)
+
+type bulkOptions struct {
+	columns       []string
+	omit          []string
+	updateColumns []string
+	maxParameters int
+}
+
+// BulkOption is a wrapper for the options of BulkInsert and BulkUpsert.
+type BulkOption func(*bulkOptions)
+
+// WithInsertColumns restricts the inserted columns to the given ones. Defaults to all columns of the struct.
+func WithInsertColumns(columns ...string) BulkOption {
+	return func(o *bulkOptions) {
+		o.columns = append(o.columns, columns...)
+	}
+}
+
+// WithOmitColumns excludes the given columns from the insert, for example an auto incremented primary key.
+func WithOmitColumns(columns ...string) BulkOption {
+	return func(o *bulkOptions) {
+		o.omit = append(o.omit, columns...)
+	}
+}
+
+// WithUpdateColumns sets the columns which BulkUpsert updates if a row exists already. Defaults to all inserted
+// columns except the conflict columns.
+func WithUpdateColumns(columns ...string) BulkOption {
+	return func(o *bulkOptions) {
+		o.updateColumns = append(o.updateColumns, columns...)
+	}
+}
+
+// WithMaxParameters overrides the maximum number of parameters per statement. Defaults to the limit of the database,
+// for example MaxParametersPostgreSQL.
+func WithMaxParameters(n int) BulkOption {
+	return func(o *bulkOptions) {
+		o.maxParameters = n
+	}
+}
+
+func newBulkOptions(driverName string, opts []BulkOption) *bulkOptions {
+	o := &bulkOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.maxParameters <= 0 {
+		o.maxParameters = maxParameters(driverName)
+	}
+	return o
+}
+
+// maxParameters returns the maximum number of parameters of a statement for the given sqlx driver name.
+func maxParameters(driverName string) int {
+	switch dialect(driverName) {
+	case DriverPostgreSQL:
+		return MaxParametersPostgreSQL
+	case DriverMySQL:
+		return MaxParametersMySQL
+	default:
+		return MaxParametersSQLite
+	}
+}
+
+// dialect maps a sqlx driver name onto one of DriverPostgreSQL, DriverMySQL and DriverSQLite.
+func dialect(driverName string) string {
+	switch driverName {
+	case DriverPostgreSQL, "pgx", "pq-timeouts", "cloudsqlpostgres":
+		return DriverPostgreSQL
+	case DriverMySQL:
+		return DriverMySQL
+	default:
+		return DriverSQLite
+	}
+}
+
+// BulkInsert inserts all elements of rows, a slice of structs or struct pointers, into table. The columns are taken
+// from the `db` tags of the struct fields like sqlx does, see WithInsertColumns and WithOmitColumns. Table and column
+// names are used as they are and must therefore not come from user input.
+//
+// The rows are inserted using multi-row INSERT statements which are split so that each statement stays below the
+// parameter limit of the database. If e is a *sqlx.DB and ctx carries a transaction, see WithTransactionContext, the
+// statements are run within that transaction. Otherwise, if more than one statement is needed, they are run in a new
+// transaction. Pass a *sqlx.Tx, for example from a WithTransaction callback, to make the insert part of another
+// transaction. BulkInsert returns the number of affected rows.
+func BulkInsert(ctx context.Context, e sqlx.ExtContext, table string, rows interface{}, opts ...BulkOption) (int64, error) {
+	return bulkExec(ctx, e, table, rows, nil, newBulkOptions(e.DriverName(), opts))
+}
+
+// BulkUpsert works like BulkInsert but updates rows which conflict with an existing row on the given columns instead
+// of failing. PostgreSQL and SQLite use INSERT ... ON CONFLICT (conflictColumns) DO UPDATE and require a unique
+// index on exactly these columns, MySQL uses INSERT ... ON DUPLICATE KEY UPDATE and ignores conflictColumns apart
+// from excluding them from the updated columns, see WithUpdateColumns.
+//
+// Please note that MySQL counts every updated row as two affected rows.
+func BulkUpsert(ctx context.Context, e sqlx.ExtContext, table string, rows interface{}, conflictColumns []string, opts ...BulkOption) (int64, error) {
+	if len(conflictColumns) == 0 {
+		return 0, errors.New("at least one conflict column is required")
+	}
+	return bulkExec(ctx, e, table, rows, conflictColumns, newBulkOptions(e.DriverName(), opts))
+}
+
+func bulkExec(ctx context.Context, e sqlx.ExtContext, table string, rows interface{}, conflictColumns []string, o *bulkOptions) (int64, error) {
+	columns, values, err := structValues(rows, o.columns, o.omit)
+	if err != nil {
+		return 0, err
+	}
+	if len(values) == 0 {
+		return 0, nil
+	}
+
+	rowsPerStatement := o.maxParameters / len(columns)
+	if rowsPerStatement < 1 {
+		return 0, errors.Errorf("a single row has %d parameters which exceeds the limit of %d", len(columns), o.maxParameters)
+	}
+
+	suffix, err := upsertClause(dialect(e.DriverName()), columns, conflictColumns, o.updateColumns)
+	if err != nil {
+		return 0, err
+	}
+
+	run := func(ctx context.Context, e sqlx.ExtContext) (affected int64, err error) {
+		for start := 0; start < len(values); start += rowsPerStatement {
+			end := start + rowsPerStatement
+			if end > len(values) {
+				end = len(values)
+			}
+
+			query, args := insertStatement(table, columns, values[start:end], suffix)
+			res, err := e.ExecContext(ctx, e.Rebind(query), args...)
+			if err != nil {
+				return affected, errors.WithStack(err)
+			}
+
+			n, err := res.RowsAffected()
+			if err != nil {
+				return affected, errors.WithStack(err)
+			}
+			affected += n
+		}
+		return affected, nil
+	}
+
+	db, ok := e.(*sqlx.DB)
+	if !ok {
+		return run(ctx, e)
+	}
+	if len(values) <= rowsPerStatement {
+		return run(ctx, ExecutorFromContext(ctx, db))
+	}
+
+	var affected int64
+	err = WithTransactionContext(ctx, db, func(ctx context.Context, tx *sqlx.Tx) (err error) {
+		affected, err = run(ctx, tx)
+		return err
+	})
+	return affected, err
+}
+
+func insertStatement(table string, columns []string, values [][]interface{}, suffix string) (string, []interface{}) {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+
+	var b strings.Builder
+	b.WriteString("INSERT INTO ")
+	b.WriteString(table)
+	b.WriteString(" (")
+	b.WriteString(strings.Join(columns, ", "))
+	b.WriteString(") VALUES ")
+
+	args := make([]interface{}, 0, len(values)*len(columns))
+	for i, v := range values {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(row)
+		args = append(args, v...)
+	}
+	b.WriteString(suffix)
+
+	return b.String(), args
+}
+
+// upsertClause returns the dialect specific clause which turns an INSERT into an upsert, or an empty string if
+// conflictColumns is empty.
+func upsertClause(dialect string, columns, conflictColumns, updateColumns []string) (string, error) {
+	if len(conflictColumns) == 0 {
+		return "", nil
+	}
+
+	if len(updateColumns) == 0 {
+		for _, c := range columns {
+			if !containsColumn(conflictColumns, c) {
+				updateColumns = append(updateColumns, c)
+			}
+		}
+	}
+	for _, c := range updateColumns {
+		if !containsColumn(columns, c) {
+			return "", errors.Errorf("update column %s is not inserted", c)
+		}
+	}
+
+	set := make([]string, len(updateColumns))
+	if dialect == DriverMySQL {
+		if len(updateColumns) == 0 {
+			// Updating a column to its own value keeps the existing row without raising an error.
+			return " ON DUPLICATE KEY UPDATE " + conflictColumns[0] + " = " + conflictColumns[0], nil
+		}
+		for i, c := range updateColumns {
+			set[i] = c + " = VALUES(" + c + ")"
+		}
+		return " ON DUPLICATE KEY UPDATE " + strings.Join(set, ", "), nil
+	}
+
+	clause := " ON CONFLICT (" + strings.Join(conflictColumns, ", ") + ") DO "
+	if len(updateColumns) == 0 {
+		return clause + "NOTHING", nil
+	}
+	for i, c := range updateColumns {
+		set[i] = c + " = EXCLUDED." + c
+	}
+	return clause + "UPDATE SET " + strings.Join(set, ", "), nil
+}
+
+// SelectIn runs a query whose arguments contain exactly one slice which is expanded into an IN (...) list, like
+// sqlx.In, and scans the results into dest using sqlx. If the slice exceeds the parameter limit of the database,
+// the query is run once per chunk and the results are appended to dest. The query must therefore not aggregate,
+// order or limit across the chunks.
+//
+// Use ColumnValues to build the slice from the fields of a slice of structs.
+func SelectIn(ctx context.Context, e sqlx.ExtContext, dest interface{}, query string, args ...interface{}) error {
+	list := -1
+	for i, arg := range args {
+		if isExpandable(arg) {
+			if list >= 0 {
+				return errors.New("SelectIn expects exactly one slice argument")
+			}
+			list = i
+		}
+	}
+	if list < 0 {
+		return errors.New("SelectIn expects exactly one slice argument")
+	}
+
+	return selectIn(ctx, e, dest, query, args, list, maxParameters(e.DriverName())-(len(args)-1))
+}
+
+func selectIn(ctx context.Context, e sqlx.ExtContext, dest interface{}, query string, args []interface{}, list, chunkSize int) error {
+	values := reflect.ValueOf(args[list])
+	if values.Len() == 0 {
+		return nil
+	}
+	if chunkSize < 1 {
+		return errors.New("the query has too many parameters")
+	}
+
+	chunkArgs := make([]interface{}, len(args))
+	copy(chunkArgs, args)
+	for start := 0; start < values.Len(); start += chunkSize {
+		end := start + chunkSize
+		if end > values.Len() {
+			end = values.Len()
+		}
+
+		chunkArgs[list] = values.Slice(start, end).Interface()
+		q, a, err := sqlx.In(query, chunkArgs...)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if err := sqlx.SelectContext(ctx, e, dest, e.Rebind(q), a...); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// isExpandable returns true if sqlx.In would expand the argument into a list.
+func isExpandable(arg interface{}) bool {
+	if _, ok := arg.(driver.Valuer); ok {
+		return false
+	}
+	v := reflect.ValueOf(arg)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	return v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8
+}
+
+// ColumnValues returns the values of the given column, as determined by the `db` tags, of all elements of rows, a
+// slice of structs or struct pointers. The result can be passed to SelectIn or sqlx.In.
+func ColumnValues(rows interface{}, column string) ([]interface{}, error) {
+	_, values, err := structValues(rows, []string{column}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]interface{}, len(values))
+	for i, v := range values {
+		result[i] = v[0]
+	}
+	return result, nil
+}
+
+// structValues returns the columns and, per element of rows, the values of the struct fields mapped onto them.
+func structValues(rows interface{}, include, omit []string) ([]string, [][]interface{}, error) {
+	v := reflect.ValueOf(rows)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice {
+		return nil, nil, errors.Errorf("expected a slice of structs but got %T", rows)
+	}
+
+	t := v.Type().Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, nil, errors.Errorf("expected a slice of structs but got %T", rows)
+	}
+
+	var columns []string
+	var fields [][]int
+	for _, f := range structFields(t, nil) {
+		if len(include) > 0 && !containsColumn(include, f.column) || containsColumn(omit, f.column) {
+			continue
+		}
+		columns = append(columns, f.column)
+		fields = append(fields, f.index)
+	}
+	for _, c := range include {
+		if !containsColumn(columns, c) {
+			return nil, nil, errors.Errorf("struct %s has no field for column %s", t, c)
+		}
+	}
+	if len(columns) == 0 {
+		return nil, nil, errors.Errorf("struct %s has no columns", t)
+	}
+
+	values := make([][]interface{}, v.Len())
+	for i := range values {
+		row := reflect.Indirect(v.Index(i))
+		if !row.IsValid() {
+			return nil, nil, errors.Errorf("element %d of the slice is nil", i)
+		}
+
+		values[i] = make([]interface{}, len(fields))
+		for j, index := range fields {
+			values[i][j] = row.FieldByIndex(index).Interface()
+		}
+	}
+	return columns, values, nil
+}
+
+type structField struct {
+	column string
+	index  []int
+}
+
+// structFields returns the exported fields of t, descending into embedded structs without a `db` tag. Columns are
+// named using the `db` tag or sqlx.NameMapper, fields tagged with `db:"-"` are skipped.
+func structFields(t reflect.Type, index []int) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("db"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+
+		fieldIndex := append(append([]int{}, index...), i)
+		if f.Anonymous && len(tag) == 0 && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, structFields(f.Type, fieldIndex)...)
+			continue
+		}
+		if len(f.PkgPath) > 0 {
+			// unexported
+			continue
+		}
+
+		if len(tag) == 0 {
+			tag = sqlx.NameMapper(f.Name)
+		}
+		fields = append(fields, structField{column: tag, index: fieldIndex})
+	}
+	return fields
+}
+
+func containsColumn(columns []string, column string) bool {
+	for _, c := range columns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package sqlcon
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bulkBase struct {
+	ID int `db:"id"`
+}
+
+type bulkRow struct {
+	bulkBase
+	Name    string `db:"name"`
+	Ignored string `db:"-"`
+	ignored string
+}
+
+func bulkRows(names ...string) []bulkRow {
+	rows := make([]bulkRow, len(names))
+	for i, name := range names {
+		rows[i] = bulkRow{bulkBase: bulkBase{ID: i + 1}, Name: name}
+	}
+	return rows
+}
+
+func TestBulkStatements(t *testing.T) {
+	columns, values, err := structValues([]*bulkRow{{bulkBase: bulkBase{ID: 1}, Name: "a"}}, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "name"}, columns)
+	assert.Equal(t, [][]interface{}{{1, "a"}}, values)
+
+	for k, tc := range []struct {
+		dialect  string
+		expected string
+	}{
+		{dialect: DriverPostgreSQL, expected: "INSERT INTO foo (id, name) VALUES ($1, $2), ($3, $4) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name"},
+		{dialect: DriverSQLite, expected: "INSERT INTO foo (id, name) VALUES (?, ?), (?, ?) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name"},
+		{dialect: DriverMySQL, expected: "INSERT INTO foo (id, name) VALUES (?, ?), (?, ?) ON DUPLICATE KEY UPDATE name = VALUES(name)"},
+	} {
+		suffix, err := upsertClause(tc.dialect, columns, []string{"id"}, nil)
+		require.NoError(t, err)
+
+		query, args := insertStatement("foo", columns, [][]interface{}{{1, "a"}, {2, "b"}}, suffix)
+		assert.Equal(t, tc.expected, sqlx.Rebind(sqlx.BindType(tc.dialect), query), "%d", k)
+		assert.Equal(t, []interface{}{1, "a", 2, "b"}, args)
+	}
+
+	suffix, err := upsertClause(DriverPostgreSQL, []string{"id"}, []string{"id"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, " ON CONFLICT (id) DO NOTHING", suffix)
+
+	_, err = upsertClause(DriverPostgreSQL, columns, []string{"id"}, []string{"foo"})
+	require.Error(t, err)
+
+	_, _, err = structValues([]string{"foo"}, nil, nil)
+	require.Error(t, err)
+	_, _, err = structValues(bulkRows("a"), []string{"foo"}, nil)
+	require.Error(t, err)
+}
+
+func TestBulkInsert(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	t.Run("case=inserts in chunks", func(t *testing.T) {
+		n, err := BulkInsert(ctx, db, "foo", bulkRows("a", "b", "c", "d", "e"), WithMaxParameters(4))
+		require.NoError(t, err)
+		assert.EqualValues(t, 5, n)
+		assert.Equal(t, 5, count(t, db))
+	})
+
+	t.Run("case=rolls back all chunks on error", func(t *testing.T) {
+		rows := bulkRows("f", "g", "h", "a")
+		_, err := BulkInsert(ctx, db, "foo", rows, WithMaxParameters(2), WithOmitColumns("id"))
+		require.Error(t, err)
+		assert.Equal(t, 5, count(t, db))
+	})
+
+	t.Run("case=runs in transaction", func(t *testing.T) {
+		err := WithTransaction(db, func(tx *sqlx.Tx) error {
+			_, err := BulkInsert(ctx, tx, "foo", bulkRows("f", "g"), WithInsertColumns("name"))
+			require.NoError(t, err)
+			return errors.New("rollback")
+		})
+		require.Error(t, err)
+		assert.Equal(t, 5, count(t, db))
+	})
+
+	t.Run("case=joins the transaction of the context", func(t *testing.T) {
+		for _, rows := range [][]bulkRow{bulkRows("f"), bulkRows("f", "g", "h")} {
+			err := WithTransactionContext(ctx, db, func(ctx context.Context, _ *sqlx.Tx) error {
+				_, err := BulkInsert(ctx, db, "foo", rows, WithInsertColumns("name"), WithMaxParameters(2))
+				require.NoError(t, err)
+				return errors.New("rollback")
+			})
+			require.Error(t, err)
+			assert.Equal(t, 5, count(t, db), "%d rows", len(rows))
+		}
+	})
+
+	t.Run("case=upserts", func(t *testing.T) {
+		rows := []bulkRow{{Name: "a"}, {Name: "z"}}
+		_, err := BulkUpsert(ctx, db, "foo", rows, []string{"name"}, WithOmitColumns("id"))
+		require.NoError(t, err)
+		assert.Equal(t, 6, count(t, db))
+
+		rows = []bulkRow{{bulkBase: bulkBase{ID: 1}, Name: "y"}}
+		_, err = BulkUpsert(ctx, db, "foo", rows, []string{"id"})
+		require.NoError(t, err)
+
+		var name string
+		require.NoError(t, db.Get(&name, "SELECT name FROM foo WHERE id = 1"))
+		assert.Equal(t, "y", name)
+	})
+
+	t.Run("case=selects in chunks", func(t *testing.T) {
+		ids, err := ColumnValues(bulkRows("a", "b", "c", "d", "e"), "id")
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{1, 2, 3, 4, 5}, ids)
+
+		var names []string
+		require.NoError(t, selectIn(ctx, db, &names, "SELECT name FROM foo WHERE id IN (?) AND name <> ?", []interface{}{ids, "e"}, 0, 2))
+		assert.ElementsMatch(t, []string{"y", "b", "c", "d"}, names)
+
+		names = nil
+		require.NoError(t, SelectIn(ctx, db, &names, "SELECT name FROM foo WHERE id IN (?)", []int{2, 3}))
+		assert.ElementsMatch(t, []string{"b", "c"}, names)
+
+		require.Error(t, SelectIn(ctx, db, &names, "SELECT name FROM foo WHERE id = ?", 1))
+	})
+}
@@ -0,0 +1,238 @@
+package sqlcon
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/luna-duclos/instrumentedsql"
+	"github.com/luna-duclos/instrumentedsql/opentracing"
+	"github.com/pkg/errors"
+)
+
+var (
+	// tracedDrivers contains the names of all wrapped drivers registered with database/sql by this package.
+	tracedDrivers    = make(map[string]bool)
+	tracedDriversMtx sync.Mutex
+)
+
+// newDriver returns the unwrapped database/sql driver for the given DSN scheme.
+func newDriver(scheme string) (driver.Driver, error) {
+	switch scheme {
+	case DriverPostgreSQL:
+		// Why does this have to be a pointer? Because the Open method for postgres has a pointer receiver
+		// and does not satisfy the driver.Driver interface.
+		return &pq.Driver{}, nil
+	case DriverMySQL:
+		return mysql.MySQLDriver{}, nil
+	case DriverSQLite:
+		// The driver is registered by github.com/open-identity/utils/sqlcon/sqlite, which requires cgo.
+		d, err := registeredDriver("sqlite3")
+		if err != nil {
+			return nil, errors.Wrap(err, `SQLite support is not enabled, import "github.com/open-identity/utils/sqlcon/sqlite"`)
+		}
+		return d, nil
+	default:
+		return nil, fmt.Errorf("unsupported scheme (%s) in DSN", scheme)
+	}
+}
+
+// connector opens new physical connections using a DSN which is resolved for every connection, runs the
+// connection hooks and wraps the connections for query logging.
+type connector struct {
+	driver    driver.Driver
+	dsn       func() (string, error)
+	onConnect []ConnHook
+	onAcquire []ConnHook
+	queryLog  *queryLogger
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	dsn, err := c.dsn()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := c.driver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := runConnHooks(ctx, conn, c.onConnect); err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrap(err, "connect hook failed")
+	}
+
+	if len(c.onAcquire) > 0 {
+		if err := runConnHooks(ctx, conn, c.onAcquire); err != nil {
+			_ = conn.Close()
+			return nil, errors.Wrap(err, "acquire hook failed")
+		}
+		conn = &acquireConn{wrappedConn: wrappedConn{conn}, hooks: c.onAcquire}
+	}
+
+	if c.queryLog != nil {
+		conn = &queryLogConn{wrappedConn: wrappedConn{conn}, log: c.queryLog}
+	}
+	return conn, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// wrappedConn forwards the optional interfaces of database/sql/driver to the wrapped connection. It falls back to
+// the behaviour of database/sql if the wrapped connection does not implement them.
+type wrappedConn struct {
+	driver.Conn
+}
+
+var (
+	_ driver.ConnBeginTx        = (*wrappedConn)(nil)
+	_ driver.ConnPrepareContext = (*wrappedConn)(nil)
+	_ driver.ExecerContext      = (*wrappedConn)(nil)
+	_ driver.QueryerContext     = (*wrappedConn)(nil)
+	_ driver.Pinger             = (*wrappedConn)(nil)
+	_ driver.NamedValueChecker  = (*wrappedConn)(nil)
+	_ driver.SessionResetter    = (*wrappedConn)(nil)
+	_ driver.Validator          = (*wrappedConn)(nil)
+)
+
+func (c *wrappedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != 0 || opts.ReadOnly {
+		return nil, errors.New("driver does not support non-default isolation levels or read-only transactions")
+	}
+	return c.Conn.Begin()
+}
+
+func (c *wrappedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *wrappedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *wrappedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *wrappedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *wrappedConn) CheckNamedValue(v *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
+
+func (c *wrappedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *wrappedConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// newDSNSource returns a function which returns the driver specific DSN for the given (cleaned) URL. If the URL
+// references secrets, they are resolved again on every call so that rotated secrets are used by new connections.
+// The DSN is resolved once up front to report errors early.
+func newDSNSource(clean *url.URL) (func() (string, error), error) {
+	if !hasSecretReferences(clean) {
+		dsn := connectionString(clean)
+		return func() (string, error) { return dsn, nil }, nil
+	}
+
+	dsn := func() (string, error) {
+		resolved, err := resolveSecrets(clean)
+		if err != nil {
+			return "", err
+		}
+		return connectionString(resolved), nil
+	}
+
+	if _, err := dsn(); err != nil {
+		return nil, err
+	}
+	return dsn, nil
+}
+
+// registeredDriver returns the driver registered with database/sql under the given name.
+func registeredDriver(name string) (driver.Driver, error) {
+	db, err := sql.Open(name, "")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer db.Close()
+	return db.Driver(), nil
+}
+
+// tracedDriverName returns the name a wrapped driver is registered under. Connections using the same scheme and
+// tracing options share one wrapped driver.
+func tracedDriverName(scheme string, o options) string {
+	if len(o.forcedDriverName) > 0 {
+		return o.forcedDriverName
+	}
+	return fmt.Sprintf("instrumented-sql-driver-%s-omitargs=%t-allowroot=%t", scheme, o.OmitArgs, o.AllowRoot)
+}
+
+// registerTracedDriver registers a driver wrapped with instrumentedsql for the given scheme and options, unless it
+// has been registered before, and returns its name. It is safe to call concurrently and any number of times.
+func registerTracedDriver(scheme string, o options) (string, error) {
+	driverName := tracedDriverName(scheme, o)
+
+	tracedDriversMtx.Lock()
+	defer tracedDriversMtx.Unlock()
+
+	if tracedDrivers[driverName] {
+		return driverName, nil
+	}
+
+	for _, registered := range sql.Drivers() {
+		if registered == driverName {
+			return "", errors.Errorf("a driver named %s has already been registered by another package", driverName)
+		}
+	}
+
+	d, err := newDriver(scheme)
+	if err != nil {
+		return "", err
+	}
+
+	tracingOpts := []instrumentedsql.Opt{instrumentedsql.WithTracer(opentracing.NewTracer(o.AllowRoot))}
+	if o.OmitArgs {
+		tracingOpts = append(tracingOpts, instrumentedsql.WithOmitArgs())
+	}
+
+	sql.Register(driverName, instrumentedsql.WrapDriver(d, tracingOpts...))
+	tracedDrivers[driverName] = true
+	return driverName, nil
+}
@@ -0,0 +1,42 @@
+package sqlcon
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterTracedDriver(t *testing.T) {
+	var wg sync.WaitGroup
+	names := make([]string, 10)
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c, err := NewSQLConnection("sqlite://:memory:", nil, WithDistributedTracing())
+			if assert.NoError(t, err) {
+				names[i], err = c.registerDriver()
+				assert.NoError(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, name := range names {
+		assert.Equal(t, names[0], name)
+	}
+
+	c, err := NewSQLConnection("sqlite://:memory:", nil, WithDistributedTracing(), WithOmitArgsFromTraceSpans())
+	require.NoError(t, err)
+	name, err := c.registerDriver()
+	require.NoError(t, err)
+	assert.NotEqual(t, names[0], name)
+
+	_, err = registerTracedDriver("postgres", options{forcedDriverName: "sqlite3"})
+	require.Error(t, err)
+
+	_, err = registerTracedDriver("oracle", options{})
+	require.Error(t, err)
+}
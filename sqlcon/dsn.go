@@ -0,0 +1,249 @@
+package sqlcon
+
+import (
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TLSMode configures whether and how TLS is used when connecting to the database. The values follow PostgreSQL's
+// sslmode parameter and are translated for other databases. The PostgreSQL driver does not support TLSModeAllow and
+// TLSModePrefer, they are rejected for postgres:// DSNs.
+type TLSMode string
+
+const (
+	TLSModeDisable    TLSMode = "disable"
+	TLSModeAllow      TLSMode = "allow"
+	TLSModePrefer     TLSMode = "prefer"
+	TLSModeRequire    TLSMode = "require"
+	TLSModeVerifyCA   TLSMode = "verify-ca"
+	TLSModeVerifyFull TLSMode = "verify-full"
+)
+
+// The DSN query parameters understood by ParseDSNOptions.
+const (
+	DSNKeyMaxConns         = "max_conns"
+	DSNKeyMaxIdleConns     = "max_idle_conns"
+	DSNKeyMaxConnLifetime  = "max_conn_lifetime"
+	DSNKeyMaxConnIdleTime  = "max_conn_idle_time"
+	DSNKeyConnectTimeout   = "connect_timeout"
+	DSNKeyStatementTimeout = "statement_timeout"
+	DSNKeyApplicationName  = "application_name"
+	DSNKeyTLSMode          = "sslmode"
+)
+
+var (
+	// poolKeys are handled by database/sql and must never be passed to the driver.
+	poolKeys = []string{
+		DSNKeyMaxConns,
+		DSNKeyMaxIdleConns,
+		DSNKeyMaxConnLifetime,
+		DSNKeyMaxConnIdleTime,
+	}
+
+	// driverKeys are translated into driver specific parameters by DSNOptions.apply.
+	driverKeys = []string{
+		DSNKeyConnectTimeout,
+		DSNKeyStatementTimeout,
+		DSNKeyApplicationName,
+		DSNKeyTLSMode,
+	}
+)
+
+// DSNOptions contains the connection pool and behaviour settings which can be set using query parameters of the DSN.
+type DSNOptions struct {
+	// MaxConns is set using max_conns and defaults to twice the number of usable CPUs.
+	MaxConns int
+
+	// MaxIdleConns is set using max_idle_conns and defaults to the number of usable CPUs.
+	MaxIdleConns int
+
+	// MaxConnLifetime is set using max_conn_lifetime, e.g. 1h. Zero means connections are reused forever.
+	MaxConnLifetime time.Duration
+
+	// MaxConnIdleTime is set using max_conn_idle_time, e.g. 10m. Zero means idle connections are not closed.
+	MaxConnIdleTime time.Duration
+
+	// ConnectTimeout is set using connect_timeout, either as a duration or as whole seconds. Zero means no timeout.
+	ConnectTimeout time.Duration
+
+	// StatementTimeout is set using statement_timeout, either as a duration or as milliseconds. Zero means
+	// no timeout.
+	StatementTimeout time.Duration
+
+	// ApplicationName is set using application_name and reported to the database if it supports it.
+	ApplicationName string
+
+	// TLSMode is set using sslmode. If empty, the driver's default is used.
+	TLSMode TLSMode
+}
+
+// DefaultDSNOptions returns the options used for parameters missing from the DSN.
+func DefaultDSNOptions() *DSNOptions {
+	return &DSNOptions{
+		MaxConns:     maxParallelism() * 2,
+		MaxIdleConns: maxParallelism(),
+	}
+}
+
+// ParseDSNOptions parses the settings contained in the DSN's query. Invalid values are reported in the returned
+// error while the returned options fall back to the default for these values, so callers may choose to ignore them.
+func ParseDSNOptions(u *url.URL) (*DSNOptions, error) {
+	o := DefaultDSNOptions()
+	q := u.Query()
+
+	var invalid []string
+	fail := func(key string, err error) {
+		invalid = append(invalid, key+"="+q.Get(key)+": "+err.Error())
+	}
+
+	if v := q.Get(DSNKeyMaxConns); v != "" {
+		if i, err := parsePositiveInt(v); err != nil {
+			fail(DSNKeyMaxConns, err)
+		} else {
+			o.MaxConns = i
+		}
+	}
+
+	if v := q.Get(DSNKeyMaxIdleConns); v != "" {
+		if i, err := parsePositiveInt(v); err != nil {
+			fail(DSNKeyMaxIdleConns, err)
+		} else {
+			o.MaxIdleConns = i
+		}
+	}
+
+	if v := q.Get(DSNKeyMaxConnLifetime); v != "" {
+		if d, err := parseDuration(v, 0); err != nil {
+			fail(DSNKeyMaxConnLifetime, err)
+		} else {
+			o.MaxConnLifetime = d
+		}
+	}
+
+	if v := q.Get(DSNKeyMaxConnIdleTime); v != "" {
+		if d, err := parseDuration(v, 0); err != nil {
+			fail(DSNKeyMaxConnIdleTime, err)
+		} else {
+			o.MaxConnIdleTime = d
+		}
+	}
+
+	if v := q.Get(DSNKeyConnectTimeout); v != "" {
+		if d, err := parseDuration(v, time.Second); err != nil {
+			fail(DSNKeyConnectTimeout, err)
+		} else {
+			o.ConnectTimeout = d
+		}
+	}
+
+	if v := q.Get(DSNKeyStatementTimeout); v != "" {
+		if d, err := parseDuration(v, time.Millisecond); err != nil {
+			fail(DSNKeyStatementTimeout, err)
+		} else {
+			o.StatementTimeout = d
+		}
+	}
+
+	o.ApplicationName = q.Get(DSNKeyApplicationName)
+
+	if v := q.Get(DSNKeyTLSMode); v != "" {
+		switch m := TLSMode(v); m {
+		case TLSModeAllow, TLSModePrefer:
+			if u.Scheme == DriverPostgreSQL {
+				// github.com/lib/pq refuses to connect with these modes.
+				fail(DSNKeyTLSMode, errors.New("TLS mode is not supported by the PostgreSQL driver"))
+			} else {
+				o.TLSMode = m
+			}
+		case TLSModeDisable, TLSModeRequire, TLSModeVerifyCA, TLSModeVerifyFull:
+			o.TLSMode = m
+		default:
+			fail(DSNKeyTLSMode, errors.New("unknown TLS mode"))
+		}
+	}
+
+	if len(invalid) > 0 {
+		return o, errors.Errorf("invalid DSN options: %s", strings.Join(invalid, "; "))
+	}
+	return o, nil
+}
+
+// apply translates the options which need to be handled by the database driver into the driver specific query
+// parameters of the given (cleaned) URL.
+func (o *DSNOptions) apply(clean *url.URL) {
+	q := clean.Query()
+	for _, key := range driverKeys {
+		q.Del(key)
+	}
+
+	switch clean.Scheme {
+	case DriverPostgreSQL:
+		if o.ConnectTimeout > 0 {
+			q.Set("connect_timeout", strconv.Itoa(int(math.Ceil(o.ConnectTimeout.Seconds()))))
+		}
+		if o.StatementTimeout > 0 {
+			q.Set("statement_timeout", strconv.FormatInt(int64(o.StatementTimeout/time.Millisecond), 10))
+		}
+		if len(o.ApplicationName) > 0 {
+			q.Set("application_name", o.ApplicationName)
+		}
+		if len(o.TLSMode) > 0 {
+			q.Set("sslmode", string(o.TLSMode))
+		}
+	case DriverMySQL:
+		if o.ConnectTimeout > 0 {
+			q.Set("timeout", o.ConnectTimeout.String())
+		}
+		if o.StatementTimeout > 0 {
+			q.Set("max_execution_time", strconv.FormatInt(int64(o.StatementTimeout/time.Millisecond), 10))
+		}
+		// The MySQL driver can not fall back to an unencrypted connection, so allow and prefer use its default.
+		switch o.TLSMode {
+		case TLSModeDisable:
+			q.Set("tls", "false")
+		case TLSModeRequire:
+			q.Set("tls", "skip-verify")
+		case TLSModeVerifyCA, TLSModeVerifyFull:
+			q.Set("tls", "true")
+		}
+	}
+	clean.RawQuery = q.Encode()
+}
+
+func parsePositiveInt(v string) (int, error) {
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if i < 0 {
+		return 0, errors.New("must not be negative")
+	}
+	return int(i), nil
+}
+
+// parseDuration parses a duration such as 1m30s. If unit is not zero, plain integers are accepted as well and
+// interpreted as multiples of unit.
+func parseDuration(v string, unit time.Duration) (time.Duration, error) {
+	if unit > 0 {
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			if i < 0 {
+				return 0, errors.New("must not be negative")
+			}
+			return time.Duration(i) * unit, nil
+		}
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if d < 0 {
+		return 0, errors.New("must not be negative")
+	}
+	return d, nil
+}
@@ -0,0 +1,150 @@
+package sqlcon
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/ory/herodot"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNoRows is returned when a query did not return any rows.
+	ErrNoRows = &herodot.DefaultError{
+		CodeField:   http.StatusNotFound,
+		StatusField: http.StatusText(http.StatusNotFound),
+		ErrorField:  "Unable to locate the resource",
+	}
+
+	// ErrUniqueViolation is returned when a statement violates a unique constraint.
+	ErrUniqueViolation = &herodot.DefaultError{
+		CodeField:   http.StatusConflict,
+		StatusField: http.StatusText(http.StatusConflict),
+		ErrorField:  "Unable to insert or update resource because a resource with that value exists already",
+	}
+
+	// ErrForeignKeyViolation is returned when a statement violates a foreign key constraint.
+	ErrForeignKeyViolation = &herodot.DefaultError{
+		CodeField:   http.StatusConflict,
+		StatusField: http.StatusText(http.StatusConflict),
+		ErrorField:  "Unable to insert, update or delete resource because it references or is referenced by another resource",
+	}
+
+	// ErrCheckViolation is returned when a statement violates a check constraint.
+	ErrCheckViolation = &herodot.DefaultError{
+		CodeField:   http.StatusBadRequest,
+		StatusField: http.StatusText(http.StatusBadRequest),
+		ErrorField:  "Unable to insert or update resource because it contains invalid values",
+	}
+
+	// ErrSerializationFailure is returned when a transaction was aborted because of a conflict with a concurrent
+	// transaction, for example a serialization failure or a deadlock. Running the transaction again may succeed.
+	ErrSerializationFailure = &herodot.DefaultError{
+		CodeField:   http.StatusConflict,
+		StatusField: http.StatusText(http.StatusConflict),
+		ErrorField:  "Unable to complete the operation because of a concurrent update, please try again",
+	}
+
+	// ErrConnectionLost is returned when the connection to the database was lost or could not be established.
+	ErrConnectionLost = &herodot.DefaultError{
+		CodeField:   http.StatusServiceUnavailable,
+		StatusField: http.StatusText(http.StatusServiceUnavailable),
+		ErrorField:  "Unable to reach the database, please try again later",
+	}
+
+	// ErrInvalidPageToken is returned when a page token is malformed, has been tampered with or belongs to another
+	// sort order, see Paginator.
+	ErrInvalidPageToken = &herodot.DefaultError{
+		CodeField:   http.StatusBadRequest,
+		StatusField: http.StatusText(http.StatusBadRequest),
+		ErrorField:  "The page token is invalid",
+	}
+
+	// ErrLockNotAcquired is returned by TryLock when the lock is held by another session.
+	ErrLockNotAcquired = &herodot.DefaultError{
+		CodeField:   http.StatusConflict,
+		StatusField: http.StatusText(http.StatusConflict),
+		ErrorField:  "Unable to acquire the lock because it is held by another session",
+	}
+)
+
+// HandleError maps database specific errors of PostgreSQL, MySQL and SQLite as well as sql.ErrNoRows onto the
+// driver independent errors of this package, for example ErrUniqueViolation. The returned error wraps the error
+// of this package, so errors.Cause(err) can be compared with it while the message retains the original error.
+// Errors which can not be mapped are returned with a stack trace. HandleError returns nil if err is nil.
+func HandleError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if mapped := mapError(errors.Cause(err)); mapped != nil {
+		return errors.Wrap(mapped, err.Error())
+	}
+	return errors.WithStack(err)
+}
+
+func mapError(err error) *herodot.DefaultError {
+	switch err {
+	case sql.ErrNoRows:
+		return ErrNoRows
+	case driver.ErrBadConn, mysql.ErrInvalidConn:
+		return ErrConnectionLost
+	case ErrNoRows, ErrUniqueViolation, ErrForeignKeyViolation, ErrCheckViolation, ErrSerializationFailure, ErrConnectionLost,
+		ErrInvalidPageToken, ErrLockNotAcquired:
+		return err.(*herodot.DefaultError)
+	}
+
+	switch e := err.(type) {
+	case *pq.Error:
+		switch e.Code {
+		case "23505": // unique_violation
+			return ErrUniqueViolation
+		case "23503": // foreign_key_violation
+			return ErrForeignKeyViolation
+		case "23514": // check_violation
+			return ErrCheckViolation
+		case "40001", // serialization_failure
+			"40P01": // deadlock_detected
+			return ErrSerializationFailure
+		case "57P01", // admin_shutdown
+			"57P02", // crash_shutdown
+			"57P03": // cannot_connect_now
+			return ErrConnectionLost
+		}
+		if e.Code.Class() == "08" { // connection_exception
+			return ErrConnectionLost
+		}
+	case *mysql.MySQLError:
+		switch e.Number {
+		case 1062: // ER_DUP_ENTRY
+			return ErrUniqueViolation
+		case 1451, // ER_ROW_IS_REFERENCED_2
+			1452: // ER_NO_REFERENCED_ROW_2
+			return ErrForeignKeyViolation
+		case 3819: // ER_CHECK_CONSTRAINT_VIOLATED
+			return ErrCheckViolation
+		case 1213, // ER_LOCK_DEADLOCK
+			1205: // ER_LOCK_WAIT_TIMEOUT
+			return ErrSerializationFailure
+		}
+	default:
+		// SQLite errors are matched by their message because their type only exists when cgo is enabled.
+		msg := err.Error()
+		switch {
+		case strings.HasPrefix(msg, "UNIQUE constraint failed"):
+			return ErrUniqueViolation
+		case strings.HasPrefix(msg, "FOREIGN KEY constraint failed"):
+			return ErrForeignKeyViolation
+		case strings.HasPrefix(msg, "CHECK constraint failed"):
+			return ErrCheckViolation
+		case strings.HasPrefix(msg, "database is locked"), strings.HasPrefix(msg, "database table is locked"):
+			return ErrSerializationFailure
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package sqlcon
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/ory/herodot"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleError(t *testing.T) {
+	for k, tc := range []struct {
+		err      error
+		expected error
+	}{
+		{err: sql.ErrNoRows, expected: ErrNoRows},
+		{err: errors.WithStack(sql.ErrNoRows), expected: ErrNoRows},
+		{err: driver.ErrBadConn, expected: ErrConnectionLost},
+		{err: &pq.Error{Code: "23505"}, expected: ErrUniqueViolation},
+		{err: &pq.Error{Code: "23503"}, expected: ErrForeignKeyViolation},
+		{err: &pq.Error{Code: "23514"}, expected: ErrCheckViolation},
+		{err: &pq.Error{Code: "40001"}, expected: ErrSerializationFailure},
+		{err: &pq.Error{Code: "08006"}, expected: ErrConnectionLost},
+		{err: &mysql.MySQLError{Number: 1062}, expected: ErrUniqueViolation},
+		{err: &mysql.MySQLError{Number: 1452}, expected: ErrForeignKeyViolation},
+		{err: &mysql.MySQLError{Number: 3819}, expected: ErrCheckViolation},
+		{err: &mysql.MySQLError{Number: 1213}, expected: ErrSerializationFailure},
+		{err: mysql.ErrInvalidConn, expected: ErrConnectionLost},
+		{err: errors.New("UNIQUE constraint failed: foo.name"), expected: ErrUniqueViolation},
+		{err: errors.WithStack(ErrUniqueViolation), expected: ErrUniqueViolation},
+	} {
+		t.Run("case="+tc.err.Error(), func(t *testing.T) {
+			err := HandleError(tc.err)
+			assert.Equal(t, tc.expected, errors.Cause(err), "%d", k)
+			assert.Contains(t, err.Error(), tc.err.Error())
+		})
+	}
+
+	assert.Nil(t, HandleError(nil))
+
+	unknown := errors.New("foo")
+	assert.Equal(t, unknown, errors.Cause(HandleError(unknown)))
+}
+
+func TestHandleErrorWritesStatusCode(t *testing.T) {
+	db := newTestDatabase(t)
+	_, err := db.Exec("INSERT INTO foo (name) VALUES (?)", "bar")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		query string
+		code  int
+	}{
+		{query: "SELECT name FROM foo WHERE name = 'baz'", code: http.StatusNotFound},
+		{query: "INSERT INTO foo (name) VALUES ('bar')", code: http.StatusConflict},
+	} {
+		t.Run("query="+tc.query, func(t *testing.T) {
+			var name string
+			err := db.Get(&name, tc.query)
+			require.Error(t, err)
+
+			w := httptest.NewRecorder()
+			herodot.NewJSONWriter(nil).WriteError(w, httptest.NewRequest("GET", "/", nil), HandleError(err))
+			assert.Equal(t, tc.code, w.Code)
+		})
+	}
+}
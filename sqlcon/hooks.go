@@ -0,0 +1,94 @@
+package sqlcon
+
+import (
+	"context"
+	"database/sql/driver"
+
+	"github.com/pkg/errors"
+)
+
+// Conn is a physical connection to the database as passed to connection hooks.
+type Conn interface {
+	// ExecContext executes a statement which does not return rows, for example SET search_path TO tenant.
+	ExecContext(ctx context.Context, query string, args ...interface{}) error
+}
+
+// ConnHook is called with a physical connection, see WithOnConnect and WithOnAcquire.
+type ConnHook func(ctx context.Context, conn Conn) error
+
+// WithOnConnect adds hooks which are called every time a new physical connection has been established, for example
+// to set session variables such as the search_path. If a hook fails, the connection is closed and the error is
+// returned to the caller which tried to use it.
+func WithOnConnect(hooks ...ConnHook) OptionModifier {
+	return func(o *options) {
+		o.onConnect = append(o.onConnect, hooks...)
+	}
+}
+
+// WithOnAcquire adds hooks which are called every time a physical connection is taken from the pool, including
+// new connections after the OnConnect hooks. If a hook fails on a connection which was used before, the connection
+// is discarded and another one is used.
+func WithOnAcquire(hooks ...ConnHook) OptionModifier {
+	return func(o *options) {
+		o.onAcquire = append(o.onAcquire, hooks...)
+	}
+}
+
+func runConnHooks(ctx context.Context, conn driver.Conn, hooks []ConnHook) error {
+	for _, hook := range hooks {
+		if err := hook(ctx, &hookConn{conn: conn}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hookConn implements Conn for a driver.Conn.
+type hookConn struct {
+	conn driver.Conn
+}
+
+func (c *hookConn) ExecContext(ctx context.Context, query string, args ...interface{}) error {
+	values := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		v, err := driver.DefaultParameterConverter.ConvertValue(arg)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		values[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+
+	if execer, ok := c.conn.(driver.ExecerContext); ok {
+		if _, err := execer.ExecContext(ctx, query, values); err != driver.ErrSkip {
+			return errors.WithStack(err)
+		}
+	}
+
+	stmt, err := c.conn.Prepare(query)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(namedValuesToValues(values))
+	return errors.WithStack(err)
+}
+
+// acquireConn wraps a physical connection to run the OnAcquire hooks whenever database/sql reuses it.
+type acquireConn struct {
+	wrappedConn
+	hooks []ConnHook
+}
+
+// ResetSession is called by database/sql before a connection is reused.
+func (c *acquireConn) ResetSession(ctx context.Context) error {
+	if err := c.wrappedConn.ResetSession(ctx); err != nil {
+		return err
+	}
+
+	if err := runConnHooks(ctx, c.Conn, c.hooks); err != nil {
+		// Makes database/sql discard the connection.
+		return driver.ErrBadConn
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package sqlcon
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tempSQLiteDSN(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "sqlcon-")
+	require.NoError(t, err)
+	return "sqlite://" + filepath.Join(dir, "db.sqlite") + "?max_conns=2&max_idle_conns=2", func() { os.RemoveAll(dir) }
+}
+
+func TestConnHooks(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("case=runs hooks on connect and acquire", func(t *testing.T) {
+		dsn, cleanup := tempSQLiteDSN(t)
+		defer cleanup()
+
+		var connects, acquires int32
+		c, err := NewSQLConnection(dsn, nil,
+			WithOnConnect(func(ctx context.Context, conn Conn) error {
+				atomic.AddInt32(&connects, 1)
+				if err := conn.ExecContext(ctx, "CREATE TEMP TABLE session (tenant TEXT)"); err != nil {
+					return err
+				}
+				return conn.ExecContext(ctx, "INSERT INTO session (tenant) VALUES (?)", "foo")
+			}),
+			WithOnAcquire(func(ctx context.Context, conn Conn) error {
+				atomic.AddInt32(&acquires, 1)
+				return conn.ExecContext(ctx, "PRAGMA busy_timeout = 1000")
+			}),
+		)
+		require.NoError(t, err)
+		defer c.Close()
+
+		db, err := c.GetDatabase()
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			var tenant string
+			require.NoError(t, db.Get(&tenant, "SELECT tenant FROM session"))
+			assert.Equal(t, "foo", tenant)
+		}
+		assert.EqualValues(t, 1, atomic.LoadInt32(&connects))
+		assert.EqualValues(t, 4, atomic.LoadInt32(&acquires))
+
+		first, err := db.Conn(ctx)
+		require.NoError(t, err)
+		second, err := db.Conn(ctx)
+		require.NoError(t, err)
+		require.NoError(t, first.Close())
+		require.NoError(t, second.Close())
+		assert.EqualValues(t, 2, atomic.LoadInt32(&connects))
+	})
+
+	t.Run("case=fails if connect hook fails", func(t *testing.T) {
+		dsn, cleanup := tempSQLiteDSN(t)
+		defer cleanup()
+
+		c, err := NewSQLConnection(dsn, nil, WithOnConnect(func(ctx context.Context, conn Conn) error {
+			return errors.New("hook failed")
+		}))
+		require.NoError(t, err)
+
+		_, err = c.GetDatabase()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "hook failed")
+	})
+
+	t.Run("case=discards connection if acquire hook fails", func(t *testing.T) {
+		dsn, cleanup := tempSQLiteDSN(t)
+		defer cleanup()
+
+		var connects, acquires int32
+		c, err := NewSQLConnection(dsn, nil,
+			WithOnConnect(func(ctx context.Context, conn Conn) error {
+				atomic.AddInt32(&connects, 1)
+				return nil
+			}),
+			WithOnAcquire(func(ctx context.Context, conn Conn) error {
+				if atomic.AddInt32(&acquires, 1) == 2 {
+					return errors.New("hook failed")
+				}
+				return nil
+			}),
+		)
+		require.NoError(t, err)
+		defer c.Close()
+
+		db, err := c.GetDatabase()
+		require.NoError(t, err)
+		require.NoError(t, db.Ping())
+		assert.EqualValues(t, 2, atomic.LoadInt32(&connects))
+	})
+}
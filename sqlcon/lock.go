@@ -0,0 +1,277 @@
+package sqlcon
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultLockKeepAlive is the default interval in which the session of a lock is checked.
+const defaultLockKeepAlive = time.Second * 10
+
+type lockOptions struct {
+	keepAlive time.Duration
+}
+
+// LockOption is a wrapper for the options of Lock and TryLock.
+type LockOption func(*lockOptions)
+
+// WithLockKeepAlive sets the interval in which the keepalive checks that the lock is still held by its session.
+// Defaults to ten seconds. A keepalive of zero or less disables the check.
+func WithLockKeepAlive(interval time.Duration) LockOption {
+	return func(o *lockOptions) {
+		o.keepAlive = interval
+	}
+}
+
+// Lock is a distributed lock backed by a session level advisory lock of the database, see SQLConnection.Lock.
+//
+// The lock holds on to one connection of the pool until it is released. Because the database releases the lock
+// as soon as that session ends, a lock is never held by a crashed process. A keepalive checks the session
+// periodically, if the lock turns out to be lost, for example because the connection was interrupted, the channel
+// returned by Lost is closed and the work protected by the lock should be stopped.
+type Lock struct {
+	name    string
+	dialect string
+	conn    *sql.Conn
+	l       logrus.FieldLogger
+
+	mtx      sync.Mutex
+	released bool
+	lost     chan struct{}
+	stop     func()
+	done     chan struct{}
+}
+
+// Lock acquires the lock with the given name, waiting until it is available or ctx is done. Locks with the same name
+// are mutually exclusive across all sessions of the database, which makes them suitable for leader election. Only
+// PostgreSQL (pg_advisory_lock) and MySQL (GET_LOCK) are supported.
+//
+// The lock must be released using Lock.Release. It is released automatically if the session ends.
+func (c *SQLConnection) Lock(ctx context.Context, name string, opts ...LockOption) (*Lock, error) {
+	db, err := c.GetDatabaseContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return acquireLock(ctx, db, c.L, name, true, opts)
+}
+
+// TryLock works like Lock but returns an error wrapping ErrLockNotAcquired instead of waiting if the lock is held
+// by another session.
+func (c *SQLConnection) TryLock(ctx context.Context, name string, opts ...LockOption) (*Lock, error) {
+	db, err := c.GetDatabaseContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return acquireLock(ctx, db, c.L, name, false, opts)
+}
+
+func acquireLock(ctx context.Context, db *sqlx.DB, l logrus.FieldLogger, name string, wait bool, opts []LockOption) (*Lock, error) {
+	o := &lockOptions{keepAlive: defaultLockKeepAlive}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	d := dialect(db.DriverName())
+	if d != DriverPostgreSQL && d != DriverMySQL {
+		return nil, errors.Errorf("locks are not supported by %s", db.DriverName())
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	lock := &Lock{
+		name:    name,
+		dialect: d,
+		conn:    conn,
+		l:       l.WithField("lock", name),
+		lost:    make(chan struct{}),
+	}
+
+	acquired, err := lock.acquire(ctx, wait)
+	if err != nil {
+		// The session is discarded because it is unknown whether the lock has been acquired.
+		discardConn(conn)
+		if ctx.Err() != nil {
+			return nil, errors.WithStack(ctx.Err())
+		}
+		return nil, err
+	}
+	if !acquired {
+		_ = conn.Close()
+		return nil, errors.Wrapf(ErrLockNotAcquired, "lock %s is held by another session", name)
+	}
+
+	if o.keepAlive > 0 {
+		lock.startKeepAlive(o.keepAlive)
+	}
+	return lock, nil
+}
+
+// key returns the key of a PostgreSQL advisory lock or the name of a MySQL lock, which is limited to 64 characters.
+func (l *Lock) key() interface{} {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(l.name))
+	if l.dialect == DriverPostgreSQL {
+		return int64(h.Sum64() & (1<<63 - 1))
+	}
+	if len(l.name) <= 64 {
+		return l.name
+	}
+	return fmt.Sprintf("sqlcon-%016x", h.Sum64())
+}
+
+func (l *Lock) acquire(ctx context.Context, wait bool) (bool, error) {
+	switch {
+	case l.dialect == DriverPostgreSQL && wait:
+		if _, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", l.key()); err != nil {
+			return false, errors.WithStack(err)
+		}
+		return true, nil
+	case l.dialect == DriverPostgreSQL:
+		var acquired bool
+		err := l.conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key()).Scan(&acquired)
+		return acquired, errors.WithStack(err)
+	}
+
+	timeout := 0
+	if wait {
+		// GET_LOCK can not be interrupted, so the lock is polled to notice when ctx is done.
+		timeout = 1
+	}
+
+	for {
+		var acquired sql.NullInt64
+		if err := l.conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", l.key(), timeout).Scan(&acquired); err != nil {
+			return false, errors.WithStack(err)
+		}
+		if acquired.Valid && acquired.Int64 == 1 {
+			return true, nil
+		}
+		if !wait {
+			return false, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return false, errors.WithStack(err)
+		}
+	}
+}
+
+// held checks that the lock is still held by its session.
+func (l *Lock) held(ctx context.Context) (bool, error) {
+	if l.dialect == DriverPostgreSQL {
+		key := uint64(l.key().(int64))
+		var held bool
+		err := l.conn.QueryRowContext(ctx,
+			"SELECT EXISTS (SELECT 1 FROM pg_locks WHERE locktype = 'advisory' AND granted AND pid = pg_backend_pid() AND classid = $1 AND objid = $2 AND objsubid = 1)",
+			int64(key>>32), int64(key&(1<<32-1)),
+		).Scan(&held)
+		return held, errors.WithStack(err)
+	}
+
+	var held sql.NullInt64
+	err := l.conn.QueryRowContext(ctx, "SELECT IS_USED_LOCK(?) = CONNECTION_ID()", l.key()).Scan(&held)
+	return held.Valid && held.Int64 == 1, errors.WithStack(err)
+}
+
+func (l *Lock) startKeepAlive(interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	l.stop = cancel
+	l.done = make(chan struct{})
+
+	go func() {
+		defer close(l.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			checkCtx, cancel := context.WithTimeout(ctx, interval)
+			held, err := l.held(checkCtx)
+			cancel()
+
+			if ctx.Err() != nil {
+				return
+			}
+			if err == nil && held {
+				continue
+			}
+
+			l.l.WithError(err).Warn("Lost the lock, its session has ended")
+			l.markLost()
+			return
+		}
+	}()
+}
+
+// markLost closes the session of the lost lock, which releases it in case the session is still alive.
+func (l *Lock) markLost() {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.released {
+		return
+	}
+	l.released = true
+	discardConn(l.conn)
+	close(l.lost)
+}
+
+// Lost returns a channel which is closed once the lock has been lost.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Release releases the lock and returns its connection to the pool. Releasing a lock more than once or after it
+// has been lost does nothing.
+func (l *Lock) Release(ctx context.Context) error {
+	if l.stop != nil {
+		l.stop()
+		<-l.done
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.released {
+		return nil
+	}
+	l.released = true
+
+	var err error
+	if l.dialect == DriverPostgreSQL {
+		_, err = l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key())
+	} else {
+		_, err = l.conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", l.key())
+	}
+	if err != nil {
+		// Ending the session releases the lock.
+		discardConn(l.conn)
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(l.conn.Close())
+}
+
+// discardConn closes the session of the connection instead of returning it to the pool.
+func discardConn(conn *sql.Conn) {
+	_ = conn.Raw(func(interface{}) error {
+		return driver.ErrBadConn
+	})
+	_ = conn.Close()
+}
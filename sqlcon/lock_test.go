@@ -0,0 +1,265 @@
+package sqlcon
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLockServer emulates the advisory lock functions of PostgreSQL and MySQL.
+type fakeLockServer struct {
+	mtx    sync.Mutex
+	owners map[string]*fakeLockConn
+}
+
+func newFakeLockDB(dialect string) (*sqlx.DB, *fakeLockServer) {
+	s := &fakeLockServer{owners: map[string]*fakeLockConn{}}
+	return sqlx.NewDb(sql.OpenDB(s), dialect), s
+}
+
+func (s *fakeLockServer) Connect(context.Context) (driver.Conn, error) {
+	return &fakeLockConn{server: s}, nil
+}
+
+func (s *fakeLockServer) Driver() driver.Driver {
+	return nil
+}
+
+func (s *fakeLockServer) Open(string) (driver.Conn, error) {
+	return &fakeLockConn{server: s}, nil
+}
+
+// kill ends all sessions holding a lock.
+func (s *fakeLockServer) kill() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for key, c := range s.owners {
+		c.killed = true
+		delete(s.owners, key)
+	}
+}
+
+func (s *fakeLockServer) tryLock(c *fakeLockConn, key string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if owner, ok := s.owners[key]; ok && owner != c {
+		return false
+	}
+	s.owners[key] = c
+	return true
+}
+
+func (s *fakeLockServer) unlock(c *fakeLockConn, key string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.owners[key] != c {
+		return false
+	}
+	delete(s.owners, key)
+	return true
+}
+
+func (s *fakeLockServer) owner(key string) *fakeLockConn {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.owners[key]
+}
+
+type fakeLockConn struct {
+	server *fakeLockServer
+	killed bool
+}
+
+func (c *fakeLockConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeLockConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeLockConn) Close() error {
+	c.server.mtx.Lock()
+	defer c.server.mtx.Unlock()
+	for key, owner := range c.server.owners {
+		if owner == c {
+			delete(c.server.owners, key)
+		}
+	}
+	return nil
+}
+
+func (c *fakeLockConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if _, err := c.run(ctx, query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (c *fakeLockConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	v, err := c.run(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeLockRows{value: v}, nil
+}
+
+func (c *fakeLockConn) run(ctx context.Context, query string, args []driver.NamedValue) (driver.Value, error) {
+	c.server.mtx.Lock()
+	killed := c.killed
+	c.server.mtx.Unlock()
+	if killed {
+		return nil, driver.ErrBadConn
+	}
+
+	key := fmt.Sprint(args[0].Value)
+	switch {
+	case strings.Contains(query, "pg_try_advisory_lock"):
+		return c.server.tryLock(c, key), nil
+	case strings.Contains(query, "pg_advisory_lock"):
+		for !c.server.tryLock(c, key) {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Millisecond):
+			}
+		}
+		return "", nil
+	case strings.Contains(query, "pg_advisory_unlock"):
+		return c.server.unlock(c, key), nil
+	case strings.Contains(query, "pg_locks"):
+		key = fmt.Sprint(args[0].Value.(int64)<<32 | args[1].Value.(int64))
+		return c.server.owner(key) == c, nil
+	case strings.Contains(query, "GET_LOCK"):
+		// The timeout is scaled down to milliseconds.
+		deadline := time.Now().Add(time.Millisecond * time.Duration(args[1].Value.(int64)))
+		for !c.server.tryLock(c, key) {
+			if time.Now().After(deadline) {
+				return int64(0), nil
+			}
+			time.Sleep(time.Millisecond / 10)
+		}
+		return int64(1), nil
+	case strings.Contains(query, "RELEASE_LOCK"):
+		if c.server.unlock(c, key) {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case strings.Contains(query, "IS_USED_LOCK"):
+		if c.server.owner(key) == c {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	}
+	return nil, errors.Errorf("unexpected query %s", query)
+}
+
+type fakeLockRows struct {
+	value driver.Value
+	done  bool
+}
+
+func (r *fakeLockRows) Columns() []string {
+	return []string{"v"}
+}
+
+func (r *fakeLockRows) Close() error {
+	return nil
+}
+
+func (r *fakeLockRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.value
+	return nil
+}
+
+func TestLock(t *testing.T) {
+	l, _ := test.NewNullLogger()
+
+	for _, dialect := range []string{DriverPostgreSQL, DriverMySQL} {
+		t.Run("dialect="+dialect, func(t *testing.T) {
+			ctx := context.Background()
+			db, server := newFakeLockDB(dialect)
+			defer db.Close()
+
+			lock, err := acquireLock(ctx, db, l, "cron", true, nil)
+			require.NoError(t, err)
+
+			_, err = acquireLock(ctx, db, l, "cron", false, nil)
+			require.Error(t, err)
+			assert.Equal(t, ErrLockNotAcquired, errors.Cause(err))
+
+			timeout, cancel := context.WithTimeout(ctx, time.Millisecond*20)
+			_, err = acquireLock(timeout, db, l, "cron", true, nil)
+			cancel()
+			require.Error(t, err)
+			assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+
+			other, err := acquireLock(ctx, db, l, "other", false, nil)
+			require.NoError(t, err)
+			require.NoError(t, other.Release(ctx))
+
+			acquired := make(chan *Lock)
+			go func() {
+				waiting, err := acquireLock(ctx, db, l, "cron", true, nil)
+				assert.NoError(t, err)
+				acquired <- waiting
+			}()
+
+			time.Sleep(time.Millisecond * 10)
+			require.NoError(t, lock.Release(ctx))
+			require.NoError(t, lock.Release(ctx))
+
+			waiting := <-acquired
+			require.NotNil(t, waiting)
+			require.NoError(t, waiting.Release(ctx))
+
+			t.Run("case=detects lost locks", func(t *testing.T) {
+				lock, err := acquireLock(ctx, db, l, "cron", false, []LockOption{WithLockKeepAlive(time.Millisecond * 5)})
+				require.NoError(t, err)
+
+				select {
+				case <-lock.Lost():
+					t.Fatal("the lock must not be lost yet")
+				case <-time.After(time.Millisecond * 20):
+				}
+
+				server.kill()
+				select {
+				case <-lock.Lost():
+				case <-time.After(time.Second * 5):
+					t.Fatal("the lock has not been lost")
+				}
+				require.NoError(t, lock.Release(ctx))
+
+				lock, err = acquireLock(ctx, db, l, "cron", false, nil)
+				require.NoError(t, err)
+				require.NoError(t, lock.Release(ctx))
+			})
+		})
+	}
+
+	t.Run("case=unsupported database", func(t *testing.T) {
+		c, err := NewSQLConnection("sqlite://:memory:", nil)
+		require.NoError(t, err)
+		defer c.Close()
+
+		_, err = c.TryLock(context.Background(), "cron")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,92 @@
+package sqlcon
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LabelDatabase is the label used to distinguish the connection pools of several databases.
+const LabelDatabase = "database"
+
+type statsCollector struct {
+	c *SQLConnection
+
+	maxOpen           *prometheus.Desc
+	open              *prometheus.Desc
+	inUse             *prometheus.Desc
+	idle              *prometheus.Desc
+	waitCount         *prometheus.Desc
+	waitDuration      *prometheus.Desc
+	maxIdleClosed     *prometheus.Desc
+	maxIdleTimeClosed *prometheus.Desc
+	maxLifetimeClosed *prometheus.Desc
+}
+
+// NewStatsCollector returns a prometheus.Collector which exports the connection pool statistics (sql.DBStats) of the
+// given connection. All metrics are labelled with the given database name. Nothing is exported until a connection
+// pool has been opened.
+func NewStatsCollector(c *SQLConnection, database string) prometheus.Collector {
+	labels := prometheus.Labels{LabelDatabase: database}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("sql", "", name), help, nil, labels)
+	}
+
+	return &statsCollector{
+		c:                 c,
+		maxOpen:           desc("max_open_connections", "Maximum number of open connections to the database."),
+		open:              desc("open_connections", "The number of established connections both in use and idle."),
+		inUse:             desc("in_use_connections", "The number of connections currently in use."),
+		idle:              desc("idle_connections", "The number of idle connections."),
+		waitCount:         desc("wait_count_total", "The total number of connections waited for."),
+		waitDuration:      desc("wait_duration_seconds_total", "The total time blocked waiting for a new connection."),
+		maxIdleClosed:     desc("max_idle_closed_total", "The total number of connections closed due to max_idle_conns."),
+		maxIdleTimeClosed: desc("max_idle_time_closed_total", "The total number of connections closed due to max_conn_idle_time."),
+		maxLifetimeClosed: desc("max_lifetime_closed_total", "The total number of connections closed due to max_conn_lifetime."),
+	}
+}
+
+// RegisterMetrics registers a collector for the connection pool statistics of this connection, see NewStatsCollector.
+// If the query log is enabled, the query duration histogram is registered as well, labelled with the given database
+// name, see WithQueryLog.
+func (c *SQLConnection) RegisterMetrics(r prometheus.Registerer, database string) error {
+	if err := r.Register(NewStatsCollector(c, database)); err != nil {
+		return err
+	}
+
+	if c.queryLog != nil {
+		return prometheus.WrapRegistererWith(prometheus.Labels{LabelDatabase: database}, r).Register(c.queryLog.duration)
+	}
+	return nil
+}
+
+func (s *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.maxOpen
+	ch <- s.open
+	ch <- s.inUse
+	ch <- s.idle
+	ch <- s.waitCount
+	ch <- s.waitDuration
+	ch <- s.maxIdleClosed
+	ch <- s.maxIdleTimeClosed
+	ch <- s.maxLifetimeClosed
+}
+
+func (s *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	s.c.dbMtx.Lock()
+	db := s.c.db
+	s.c.dbMtx.Unlock()
+
+	if db == nil {
+		return
+	}
+
+	stats := db.Stats()
+	ch <- prometheus.MustNewConstMetric(s.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(s.open, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(s.inUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(s.idle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(s.waitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(s.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(s.maxIdleClosed, prometheus.CounterValue, float64(stats.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(s.maxIdleTimeClosed, prometheus.CounterValue, float64(stats.MaxIdleTimeClosed))
+	ch <- prometheus.MustNewConstMetric(s.maxLifetimeClosed, prometheus.CounterValue, float64(stats.MaxLifetimeClosed))
+}
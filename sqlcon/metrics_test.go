@@ -0,0 +1,40 @@
+package sqlcon
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsCollector(t *testing.T) {
+	c, err := NewSQLConnection("sqlite://:memory:?max_conns=7", nil)
+	require.NoError(t, err)
+	defer c.Close()
+
+	r := prometheus.NewRegistry()
+	require.NoError(t, c.RegisterMetrics(r, "hydra"))
+
+	families, err := r.Gather()
+	require.NoError(t, err)
+	assert.Empty(t, families, "nothing is exported before the pool is opened")
+
+	_, err = c.GetDatabase()
+	require.NoError(t, err)
+
+	require.NoError(t, testutil.GatherAndCompare(r, strings.NewReader(`
+# HELP sql_max_open_connections Maximum number of open connections to the database.
+# TYPE sql_max_open_connections gauge
+sql_max_open_connections{database="hydra"} 7
+# HELP sql_open_connections The number of established connections both in use and idle.
+# TYPE sql_open_connections gauge
+sql_open_connections{database="hydra"} 1
+`), "sql_max_open_connections", "sql_open_connections"))
+
+	other, err := NewSQLConnection("sqlite://:memory:", nil)
+	require.NoError(t, err)
+	require.NoError(t, other.RegisterMetrics(r, "keto"))
+}
@@ -1,18 +1,33 @@
 package sqlcon
 
-import "github.com/pborman/uuid"
+import (
+	"time"
+
+	"github.com/pborman/uuid"
+)
 
 type options struct {
-	UseTracedDriver  bool
-	OmitArgs         bool
-	AllowRoot        bool
-	forcedDriverName string
+	UseTracedDriver     bool
+	OmitArgs            bool
+	AllowRoot           bool
+	StrictDSNOptions    bool
+	ReplicaSelection    ReplicaSelection
+	ReplicaDownTime     time.Duration
+	replicaDSNs         []string
+	sensitiveParameters []string
+	tlsConfig           *TLSConfig
+	onConnect           []ConnHook
+	onAcquire           []ConnHook
+	queryLog            *queryLogOptions
+	supervisorInterval  time.Duration
+	forcedDriverName    string
 }
 
 // OptionModifier is a wrapper for options.
 type OptionModifier func(*options)
 
-// WithDistributedTracing will make it so that a wrapped driver is used that supports the opentracing API.
+// WithDistributedTracing will make it so that a wrapped driver is used that supports the opentracing API. Spans are
+// recorded using the global tracer, use tracing.NewRedactingTracer to keep DSNs out of them.
 func WithDistributedTracing() OptionModifier {
 	return func(o *options) {
 		o.UseTracedDriver = true
@@ -34,7 +49,49 @@ func WithAllowRoot() OptionModifier {
 	}
 }
 
+// WithStrictDSNOptions will make NewSQLConnection fail if the DSN contains invalid options (e.g. max_conns=foo)
+// instead of logging a warning and using the default values.
+func WithStrictDSNOptions() OptionModifier {
+	return func(o *options) {
+		o.StrictDSNOptions = true
+	}
+}
+
+// WithReplicas adds read replicas to the connection. Reads can be routed to them using GetReader, while
+// GetWriter and GetDatabase always use the primary DSN. Replicas share all other options with the primary.
+func WithReplicas(dsns ...string) OptionModifier {
+	return func(o *options) {
+		o.replicaDSNs = append(o.replicaDSNs, dsns...)
+	}
+}
+
+// WithReplicaSelection sets the strategy used to pick a read replica. Defaults to ReplicaRoundRobin.
+func WithReplicaSelection(s ReplicaSelection) OptionModifier {
+	return func(o *options) {
+		o.ReplicaSelection = s
+	}
+}
+
+// WithReplicaDownTime sets the maximum time a read replica is skipped after failing. The time a replica is
+// marked down for grows exponentially with consecutive failures until it reaches this value. Defaults to one minute.
+func WithReplicaDownTime(d time.Duration) OptionModifier {
+	return func(o *options) {
+		o.ReplicaDownTime = d
+	}
+}
+
+// WithSensitiveParameters adds query parameters which are masked whenever the DSN is logged, in addition to
+// dsnx.DefaultSensitiveParameters.
+func WithSensitiveParameters(params ...string) OptionModifier {
+	return func(o *options) {
+		o.sensitiveParameters = append(o.sensitiveParameters, params...)
+	}
+}
+
 // WithRandomDriverName is specifically for writing tests as you can't register a driver with the same name more than once.
+//
+// Deprecated: traced drivers are shared between connections with the same scheme and tracing options, so
+// registering them more than once no longer panics. Using this option registers a new driver per connection.
 func WithRandomDriverName() OptionModifier {
 	return func(o *options) {
 		o.forcedDriverName = uuid.New()
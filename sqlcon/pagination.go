@@ -0,0 +1,308 @@
+package sqlcon
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+var numberedPlaceholder = regexp.MustCompile(`\$[0-9]+`)
+
+// SortColumn is a column of the sort order used by a Paginator.
+type SortColumn struct {
+	// Column is the name of the column in the result set. It must also be the column's `db` tag.
+	Column string
+	// Descending sorts the column in descending instead of ascending order.
+	Descending bool
+}
+
+// Paginator pages through the results of a query using keyset pagination, also known as the seek method. Instead of
+// skipping rows with OFFSET, every page starts after the last row of the previous page, which is encoded in an
+// opaque page token. Page tokens are signed, so tokens which have been tampered with are rejected.
+//
+// The sort columns must not contain NULL values and together they must identify a row uniquely, usually by ending
+// with the primary key.
+type Paginator struct {
+	secret  []byte
+	columns []SortColumn
+}
+
+// NewPaginator returns a Paginator which sorts by the given columns and signs page tokens with secret.
+func NewPaginator(secret []byte, columns ...SortColumn) (*Paginator, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("a secret is required to sign page tokens")
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("at least one sort column is required")
+	}
+	return &Paginator{secret: secret, columns: columns}, nil
+}
+
+// Page runs query with args and scans up to limit rows of the page identified by pageToken into dest, a pointer to
+// a slice of structs, using sqlx. An empty pageToken returns the first page. Page returns the token of the next page,
+// which is empty if there are no more rows. If pageToken is invalid, an error wrapping ErrInvalidPageToken is
+// returned.
+//
+// query must not contain ORDER BY or LIMIT clauses. It is wrapped in a sub query which is filtered, sorted and
+// limited using the sort columns. PostgreSQL and MySQL merge such sub queries into the outer query, so indexes on
+// the sort columns are used.
+//
+// query must use ? placeholders, also for PostgreSQL, because the placeholders of the filter are appended to it
+// before the whole query is rebound for the driver. Queries containing numbered placeholders ($1) are rejected.
+func (p *Paginator) Page(ctx context.Context, e sqlx.ExtContext, dest interface{}, query string, pageToken string, limit int, args ...interface{}) (string, error) {
+	if limit < 1 {
+		return "", errors.New("limit must be positive")
+	}
+	if numberedPlaceholder.MatchString(query) {
+		return "", errors.New("query must use ? instead of numbered placeholders")
+	}
+
+	slice := reflect.ValueOf(dest)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		return "", errors.Errorf("expected a pointer to a slice but got %T", dest)
+	}
+	slice = slice.Elem()
+
+	var b strings.Builder
+	b.WriteString("SELECT * FROM (")
+	b.WriteString(query)
+	b.WriteString(") sqlcon_page")
+
+	if len(pageToken) > 0 {
+		key, err := p.decodeToken(pageToken)
+		if err != nil {
+			return "", err
+		}
+
+		where, whereArgs := p.where(dialect(e.DriverName()), key)
+		b.WriteString(" WHERE ")
+		b.WriteString(where)
+		args = append(append([]interface{}{}, args...), whereArgs...)
+	}
+
+	b.WriteString(" ORDER BY ")
+	b.WriteString(p.orderBy())
+	b.WriteString(fmt.Sprintf(" LIMIT %d", limit+1))
+
+	slice.Set(slice.Slice(0, 0))
+	if err := sqlx.SelectContext(ctx, e, dest, e.Rebind(b.String()), args...); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	if slice.Len() <= limit {
+		return "", nil
+	}
+
+	slice.Set(slice.Slice(0, limit))
+	key, err := p.key(slice.Index(limit - 1))
+	if err != nil {
+		return "", err
+	}
+	return p.encodeToken(key)
+}
+
+func (p *Paginator) orderBy() string {
+	order := make([]string, len(p.columns))
+	for i, c := range p.columns {
+		order[i] = c.Column
+		if c.Descending {
+			order[i] += " DESC"
+		}
+	}
+	return strings.Join(order, ", ")
+}
+
+// where returns the condition selecting all rows after the given key. PostgreSQL compares row values if all columns
+// are sorted in the same direction, which is able to use a multi-column index. Otherwise the comparison is expanded
+// into (a > ?) OR (a = ? AND b > ?) and so on, which MySQL optimizes better than row values.
+func (p *Paginator) where(dialect string, key []interface{}) (string, []interface{}) {
+	sameDirection := true
+	for _, c := range p.columns {
+		sameDirection = sameDirection && c.Descending == p.columns[0].Descending
+	}
+
+	if dialect == DriverPostgreSQL && sameDirection {
+		columns := make([]string, len(p.columns))
+		for i, c := range p.columns {
+			columns[i] = c.Column
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(p.columns)), ", ")
+		return fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ", "), comparison(p.columns[0]), placeholders), key
+	}
+
+	var args []interface{}
+	disjunction := make([]string, len(p.columns))
+	for i, c := range p.columns {
+		conjunction := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			conjunction = append(conjunction, p.columns[j].Column+" = ?")
+			args = append(args, key[j])
+		}
+		conjunction = append(conjunction, c.Column+" "+comparison(c)+" ?")
+		args = append(args, key[i])
+		disjunction[i] = "(" + strings.Join(conjunction, " AND ") + ")"
+	}
+	return "(" + strings.Join(disjunction, " OR ") + ")", args
+}
+
+func comparison(c SortColumn) string {
+	if c.Descending {
+		return "<"
+	}
+	return ">"
+}
+
+// key returns the values of the sort columns of the given struct.
+func (p *Paginator) key(row reflect.Value) ([]interface{}, error) {
+	row = reflect.Indirect(row)
+	if row.Kind() != reflect.Struct {
+		return nil, errors.Errorf("expected a slice of structs but got a slice of %s", row.Type())
+	}
+
+	fields := map[string][]int{}
+	for _, f := range structFields(row.Type(), nil) {
+		fields[f.column] = f.index
+	}
+
+	key := make([]interface{}, len(p.columns))
+	for i, c := range p.columns {
+		index, ok := fields[c.Column]
+		if !ok {
+			return nil, errors.Errorf("struct %s has no field for sort column %s", row.Type(), c.Column)
+		}
+
+		v := row.FieldByIndex(index).Interface()
+		if valuer, ok := v.(driver.Valuer); ok {
+			var err error
+			if v, err = valuer.Value(); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+		key[i] = v
+	}
+	return key, nil
+}
+
+// tokenValue is a typed value of a page token, so that it is passed to the driver with its original type.
+type tokenValue struct {
+	Type  string          `json:"t"`
+	Value json.RawMessage `json:"v"`
+}
+
+func (p *Paginator) encodeToken(key []interface{}) (string, error) {
+	values := make([]tokenValue, len(key))
+	for i, k := range key {
+		var t string
+		switch v := reflect.ValueOf(k); v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			t, k = "int", v.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			t, k = "uint", v.Uint()
+		case reflect.Float32, reflect.Float64:
+			t, k = "float", v.Float()
+		case reflect.String:
+			t, k = "string", v.String()
+		case reflect.Bool:
+			t, k = "bool", v.Bool()
+		default:
+			switch k.(type) {
+			case time.Time:
+				t = "time"
+			case []byte:
+				t = "bytes"
+			default:
+				return "", errors.Errorf("sort column %s has the unsupported type %T", p.columns[i].Column, k)
+			}
+		}
+
+		raw, err := json.Marshal(k)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		values[i] = tokenValue{Type: t, Value: raw}
+	}
+
+	payload, err := json.Marshal(values)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(p.sign(payload)), nil
+}
+
+func (p *Paginator) decodeToken(token string) ([]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, errors.Wrap(ErrInvalidPageToken, "page token is malformed")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidPageToken, err.Error())
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidPageToken, err.Error())
+	}
+	if !hmac.Equal(signature, p.sign(payload)) {
+		return nil, errors.Wrap(ErrInvalidPageToken, "page token signature is invalid")
+	}
+
+	var values []tokenValue
+	if err := json.Unmarshal(payload, &values); err != nil {
+		return nil, errors.Wrap(ErrInvalidPageToken, err.Error())
+	}
+	if len(values) != len(p.columns) {
+		return nil, errors.Wrap(ErrInvalidPageToken, "page token does not match the sort columns")
+	}
+
+	key := make([]interface{}, len(values))
+	for i, v := range values {
+		var target interface{}
+		switch v.Type {
+		case "int":
+			target = new(int64)
+		case "uint":
+			target = new(uint64)
+		case "float":
+			target = new(float64)
+		case "string":
+			target = new(string)
+		case "bool":
+			target = new(bool)
+		case "time":
+			target = new(time.Time)
+		case "bytes":
+			target = new([]byte)
+		default:
+			return nil, errors.Wrapf(ErrInvalidPageToken, "page token contains the unknown type %s", v.Type)
+		}
+
+		if err := json.Unmarshal(v.Value, target); err != nil {
+			return nil, errors.Wrap(ErrInvalidPageToken, err.Error())
+		}
+		key[i] = reflect.ValueOf(target).Elem().Interface()
+	}
+	return key, nil
+}
+
+// sign returns the HMAC of the payload. The sort columns are part of the signature, so tokens can not be used with
+// another sort order.
+func (p *Paginator) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+	_, _ = mac.Write([]byte(p.orderBy()))
+	_, _ = mac.Write([]byte{0})
+	_, _ = mac.Write(payload)
+	return mac.Sum(nil)
+}
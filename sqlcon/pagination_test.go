@@ -0,0 +1,118 @@
+package sqlcon
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pageRow struct {
+	ID    int    `db:"id"`
+	Score int    `db:"score"`
+	Name  string `db:"name"`
+}
+
+func TestPaginatorWhere(t *testing.T) {
+	p, err := NewPaginator([]byte("secret"), SortColumn{Column: "score"}, SortColumn{Column: "id"})
+	require.NoError(t, err)
+
+	where, args := p.where(DriverPostgreSQL, []interface{}{1, 2})
+	assert.Equal(t, "(score, id) > (?, ?)", where)
+	assert.Equal(t, []interface{}{1, 2}, args)
+
+	where, args = p.where(DriverMySQL, []interface{}{1, 2})
+	assert.Equal(t, "((score > ?) OR (score = ? AND id > ?))", where)
+	assert.Equal(t, []interface{}{1, 1, 2}, args)
+
+	p, err = NewPaginator([]byte("secret"), SortColumn{Column: "score", Descending: true}, SortColumn{Column: "id"})
+	require.NoError(t, err)
+
+	where, _ = p.where(DriverPostgreSQL, []interface{}{1, 2})
+	assert.Equal(t, "((score < ?) OR (score = ? AND id > ?))", where)
+
+	_, err = NewPaginator(nil, SortColumn{Column: "id"})
+	require.Error(t, err)
+	_, err = NewPaginator([]byte("secret"))
+	require.Error(t, err)
+}
+
+func TestPaginator(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+	_, err := db.Exec("ALTER TABLE foo ADD COLUMN score INTEGER NOT NULL DEFAULT 0")
+	require.NoError(t, err)
+	for i, name := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		_, err := db.Exec("INSERT INTO foo (name, score) VALUES (?, ?)", name, i%3)
+		require.NoError(t, err)
+	}
+
+	for k, tc := range []struct {
+		columns  []SortColumn
+		expected string
+	}{
+		{columns: []SortColumn{{Column: "score"}, {Column: "id"}}, expected: "adgbecf"},
+		{columns: []SortColumn{{Column: "score", Descending: true}, {Column: "id"}}, expected: "cfbeadg"},
+		{columns: []SortColumn{{Column: "score", Descending: true}, {Column: "id", Descending: true}}, expected: "fcebgda"},
+	} {
+		p, err := NewPaginator([]byte("secret"), tc.columns...)
+		require.NoError(t, err)
+
+		var names []string
+		var token string
+		for pages := 0; pages < 10; pages++ {
+			var rows []pageRow
+			token, err = p.Page(ctx, db, &rows, "SELECT id, score, name FROM foo WHERE name <> ?", token, 2, "x")
+			require.NoError(t, err, "%d", k)
+			require.True(t, len(rows) <= 2)
+			for _, r := range rows {
+				names = append(names, r.Name)
+			}
+			if token == "" {
+				break
+			}
+		}
+		assert.Equal(t, tc.expected, strings.Join(names, ""), "%d", k)
+	}
+
+	t.Run("case=rejects invalid tokens", func(t *testing.T) {
+		p, err := NewPaginator([]byte("secret"), SortColumn{Column: "id"})
+		require.NoError(t, err)
+
+		var rows []pageRow
+		token, err := p.Page(ctx, db, &rows, "SELECT id, score, name FROM foo", "", 3)
+		require.NoError(t, err)
+		require.NotEmpty(t, token)
+
+		other, err := NewPaginator([]byte("other"), SortColumn{Column: "id"})
+		require.NoError(t, err)
+		reversed, err := NewPaginator([]byte("secret"), SortColumn{Column: "id", Descending: true})
+		require.NoError(t, err)
+
+		for k, tc := range []struct {
+			p     *Paginator
+			token string
+		}{
+			{p: p, token: "foo"},
+			{p: p, token: "x" + token},
+			{p: other, token: token},
+			{p: reversed, token: token},
+		} {
+			_, err := tc.p.Page(ctx, db, &rows, "SELECT id, score, name FROM foo", tc.token, 3)
+			require.Error(t, err, "%d", k)
+			assert.Equal(t, ErrInvalidPageToken, errors.Cause(err), "%d", k)
+		}
+	})
+
+	t.Run("case=rejects numbered placeholders", func(t *testing.T) {
+		p, err := NewPaginator([]byte("secret"), SortColumn{Column: "id"})
+		require.NoError(t, err)
+
+		var rows []pageRow
+		_, err = p.Page(ctx, db, &rows, "SELECT id, score, name FROM foo WHERE name <> $1", "", 3, "x")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,299 @@
+package sqlcon
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// LabelStatement is the label of the query duration histogram which contains the normalised statement.
+const LabelStatement = "statement"
+
+type queryLogOptions struct {
+	slowThreshold time.Duration
+	duration      *prometheus.HistogramVec
+}
+
+// WithQueryLog enables the query log. Every statement is logged at debug level with its fingerprint, normalised
+// text, duration and the number of rows it returned or affected. Statements taking at least slowThreshold are logged
+// as warnings instead, a slowThreshold of zero or less disables these warnings.
+//
+// The durations are additionally exported as the histogram sql_query_duration_seconds labelled by the normalised
+// statement, see RegisterMetrics. Query arguments are never logged and literals are removed from the statements.
+// The query log works independently of WithDistributedTracing.
+func WithQueryLog(slowThreshold time.Duration) OptionModifier {
+	return func(o *options) {
+		o.queryLog = &queryLogOptions{
+			slowThreshold: slowThreshold,
+			duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Name:    "sql_query_duration_seconds",
+				Help:    "Duration of SQL statements including fetching their rows, by normalised statement.",
+				Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+			}, []string{LabelStatement}),
+		}
+	}
+}
+
+var (
+	queryLogComments    = regexp.MustCompile(`(?s)/\*.*?\*/|--[^\n]*`)
+	queryLogLiterals    = regexp.MustCompile(`'(?:[^']|'')*'|\$\d+|\b\d+(?:\.\d+)?\b`)
+	queryLogWhitespace  = regexp.MustCompile(`\s+`)
+	queryLogLists       = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)+\s*\)`)
+	queryLogMultiValues = regexp.MustCompile(`\(\?\)(?:\s*,\s*\(\?\))+`)
+)
+
+// NormalizeQuery returns the statement with comments and literals removed, placeholders and literals replaced by
+// ? and lists of values collapsed into a single one, so that statements which only differ in their values are
+// normalised to the same text.
+func NormalizeQuery(query string) string {
+	query = queryLogComments.ReplaceAllString(query, " ")
+	query = queryLogLiterals.ReplaceAllString(query, "?")
+	query = queryLogWhitespace.ReplaceAllString(query, " ")
+	query = queryLogLists.ReplaceAllString(query, "(?)")
+	query = queryLogMultiValues.ReplaceAllString(query, "(?)")
+	return strings.TrimSpace(query)
+}
+
+// QueryFingerprint returns a short hash of the normalised statement, see NormalizeQuery.
+func QueryFingerprint(query string) string {
+	return fingerprint(NormalizeQuery(query))
+}
+
+func fingerprint(normalized string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(normalized))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// queryLogger records the statements executed on the connections of one pool.
+type queryLogger struct {
+	l logrus.FieldLogger
+	*queryLogOptions
+}
+
+func (q *queryLogger) record(query string, start time.Time, rows int64, err error) {
+	duration := time.Since(start)
+	normalized := NormalizeQuery(query)
+	q.duration.WithLabelValues(normalized).Observe(duration.Seconds())
+
+	l := q.l.WithFields(logrus.Fields{
+		"fingerprint": fingerprint(normalized),
+		"statement":   normalized,
+		"duration":    duration,
+		"rows":        rows,
+	})
+	if err != nil {
+		l = l.WithError(err)
+	}
+
+	if q.slowThreshold > 0 && duration >= q.slowThreshold {
+		l.Warn("Slow SQL query")
+		return
+	}
+	l.Debug("Executed SQL query")
+}
+
+// queryLogConn records every statement executed on the wrapped connection.
+type queryLogConn struct {
+	wrappedConn
+	log *queryLogger
+}
+
+func (c *queryLogConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	res, err := c.wrappedConn.ExecContext(ctx, query, args)
+	if err == driver.ErrSkip {
+		// database/sql prepares the statement instead, which is recorded by queryLogStmt.
+		return nil, err
+	}
+	c.log.record(query, start, rowsAffected(res), err)
+	return res, err
+}
+
+func (c *queryLogConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.wrappedConn.QueryContext(ctx, query, args)
+	if err == driver.ErrSkip {
+		return nil, err
+	}
+	if err != nil {
+		c.log.record(query, start, 0, err)
+		return nil, err
+	}
+	return &queryLogRows{Rows: rows, log: c.log, query: query, start: start}, nil
+}
+
+func (c *queryLogConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.wrappedConn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &queryLogStmt{Stmt: stmt, log: c.log, query: query}, nil
+}
+
+func rowsAffected(res driver.Result) int64 {
+	if res == nil {
+		return 0
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// queryLogStmt records every execution of the wrapped prepared statement.
+type queryLogStmt struct {
+	driver.Stmt
+	log   *queryLogger
+	query string
+}
+
+var (
+	_ driver.StmtExecContext   = (*queryLogStmt)(nil)
+	_ driver.StmtQueryContext  = (*queryLogStmt)(nil)
+	_ driver.NamedValueChecker = (*queryLogStmt)(nil)
+)
+
+func (s *queryLogStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+
+	var res driver.Result
+	var err error
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err = e.ExecContext(ctx, args)
+	} else {
+		res, err = s.Stmt.Exec(namedValuesToValues(args))
+	}
+
+	s.log.record(s.query, start, rowsAffected(res), err)
+	return res, err
+}
+
+func (s *queryLogStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+
+	var rows driver.Rows
+	var err error
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(ctx, args)
+	} else {
+		rows, err = s.Stmt.Query(namedValuesToValues(args))
+	}
+
+	if err != nil {
+		s.log.record(s.query, start, 0, err)
+		return nil, err
+	}
+	return &queryLogRows{Rows: rows, log: s.log, query: s.query, start: start}, nil
+}
+
+func (s *queryLogStmt) CheckNamedValue(v *driver.NamedValue) error {
+	if n, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
+
+func namedValuesToValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+// queryLogRows counts the rows read from the wrapped rows and records the statement once they are closed.
+type queryLogRows struct {
+	driver.Rows
+	log   *queryLogger
+	query string
+	start time.Time
+	count int64
+	err   error
+}
+
+var (
+	_ driver.RowsNextResultSet              = (*queryLogRows)(nil)
+	_ driver.RowsColumnTypeScanType         = (*queryLogRows)(nil)
+	_ driver.RowsColumnTypeDatabaseTypeName = (*queryLogRows)(nil)
+	_ driver.RowsColumnTypeLength           = (*queryLogRows)(nil)
+	_ driver.RowsColumnTypeNullable         = (*queryLogRows)(nil)
+	_ driver.RowsColumnTypePrecisionScale   = (*queryLogRows)(nil)
+)
+
+func (r *queryLogRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	switch err {
+	case nil:
+		r.count++
+	case io.EOF:
+	default:
+		r.err = err
+	}
+	return err
+}
+
+func (r *queryLogRows) Close() error {
+	err := r.Rows.Close()
+	r.log.record(r.query, r.start, r.count, r.err)
+	return err
+}
+
+func (r *queryLogRows) HasNextResultSet() bool {
+	if n, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return n.HasNextResultSet()
+	}
+	return false
+}
+
+func (r *queryLogRows) NextResultSet() error {
+	if n, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return n.NextResultSet()
+	}
+	return io.EOF
+}
+
+func (r *queryLogRows) ColumnTypeScanType(index int) reflect.Type {
+	if c, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return c.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(interface{})).Elem()
+}
+
+func (r *queryLogRows) ColumnTypeDatabaseTypeName(index int) string {
+	if c, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return c.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *queryLogRows) ColumnTypeLength(index int) (int64, bool) {
+	if c, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return c.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *queryLogRows) ColumnTypeNullable(index int) (bool, bool) {
+	if c, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+		return c.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *queryLogRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if c, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return c.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,122 @@
+package sqlcon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	for k, tc := range []struct {
+		query    string
+		expected string
+	}{
+		{query: "SELECT * FROM foo WHERE id = $1", expected: "SELECT * FROM foo WHERE id = ?"},
+		{query: "SELECT *\n\tFROM foo -- all of them\nWHERE name = 'it''s' AND n > 10.5", expected: "SELECT * FROM foo WHERE name = ? AND n > ?"},
+		{query: "SELECT /* hint */ id FROM table1 WHERE id IN (1, 2, 3)", expected: "SELECT id FROM table1 WHERE id IN (?)"},
+		{query: "INSERT INTO foo (id, name) VALUES (?, ?), (?, ?), (?, ?)", expected: "INSERT INTO foo (id, name) VALUES (?)"},
+	} {
+		assert.Equal(t, tc.expected, NormalizeQuery(tc.query), "%d", k)
+	}
+
+	assert.Equal(t, QueryFingerprint("SELECT * FROM foo WHERE id = 1"), QueryFingerprint("SELECT * FROM foo WHERE id = 2"))
+	assert.NotEqual(t, QueryFingerprint("SELECT * FROM foo"), QueryFingerprint("SELECT * FROM bar"))
+}
+
+func TestQueryLog(t *testing.T) {
+	l, hook := test.NewNullLogger()
+	l.Level = logrus.DebugLevel
+
+	c, err := NewSQLConnection("sqlite://:memory:", l, WithQueryLog(time.Hour))
+	require.NoError(t, err)
+	defer c.Close()
+
+	r := prometheus.NewRegistry()
+	require.NoError(t, c.RegisterMetrics(r, "hydra"))
+
+	db, err := c.GetDatabase()
+	require.NoError(t, err)
+
+	_, err = db.Exec("CREATE TABLE foo (id INTEGER PRIMARY KEY, name TEXT)")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO foo (name) VALUES (?), (?), (?)", "a", "b", "c")
+	require.NoError(t, err)
+
+	hook.Reset()
+	var names []string
+	require.NoError(t, db.Select(&names, "SELECT name FROM foo WHERE id > ?", 1))
+	assert.Equal(t, []string{"b", "c"}, names)
+
+	entry := hook.LastEntry()
+	require.NotNil(t, entry)
+	assert.Equal(t, logrus.DebugLevel, entry.Level)
+	assert.Equal(t, "SELECT name FROM foo WHERE id > ?", entry.Data["statement"])
+	assert.Equal(t, QueryFingerprint("SELECT name FROM foo WHERE id > ?"), entry.Data["fingerprint"])
+	assert.EqualValues(t, 2, entry.Data["rows"])
+
+	_, err = db.Exec("UPDATE foo SET name = 'd'")
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, hook.LastEntry().Data["rows"])
+
+	stmt, err := db.Preparex("DELETE FROM foo WHERE id = ?")
+	require.NoError(t, err)
+	_, err = stmt.Exec(1)
+	require.NoError(t, err)
+	require.NoError(t, stmt.Close())
+	assert.Equal(t, "DELETE FROM foo WHERE id = ?", hook.LastEntry().Data["statement"])
+	assert.EqualValues(t, 1, hook.LastEntry().Data["rows"])
+
+	t.Run("case=exports durations", func(t *testing.T) {
+		families, err := r.Gather()
+		require.NoError(t, err)
+
+		var found bool
+		for _, f := range families {
+			if f.GetName() != "sql_query_duration_seconds" {
+				continue
+			}
+			for _, m := range f.GetMetric() {
+				labels := map[string]string{}
+				for _, lp := range m.GetLabel() {
+					labels[lp.GetName()] = lp.GetValue()
+				}
+				assert.Equal(t, "hydra", labels[LabelDatabase])
+				if labels[LabelStatement] == "INSERT INTO foo (name) VALUES (?)" {
+					found = true
+					assert.EqualValues(t, 1, m.GetHistogram().GetSampleCount())
+				}
+			}
+		}
+		assert.True(t, found)
+	})
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	l, hook := test.NewNullLogger()
+
+	c, err := NewSQLConnection("sqlite://:memory:", l, WithQueryLog(time.Nanosecond))
+	require.NoError(t, err)
+	defer c.Close()
+
+	db, err := c.GetDatabase()
+	require.NoError(t, err)
+
+	hook.Reset()
+	_, err = db.Exec("SELECT 1")
+	require.NoError(t, err)
+
+	entry := hook.LastEntry()
+	require.NotNil(t, entry)
+	assert.Equal(t, logrus.WarnLevel, entry.Level)
+	assert.Equal(t, "Slow SQL query", entry.Message)
+	assert.Equal(t, "SELECT ?", entry.Data["statement"])
+
+	_, err = db.Exec("SELECT * FROM does_not_exist")
+	require.Error(t, err)
+	assert.Error(t, hook.LastEntry().Data[logrus.ErrorKey].(error))
+}
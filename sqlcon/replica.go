@@ -0,0 +1,197 @@
+package sqlcon
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// ReplicaSelection is the strategy used to pick a read replica.
+type ReplicaSelection int
+
+const (
+	// ReplicaRoundRobin uses all healthy read replicas in turn.
+	ReplicaRoundRobin ReplicaSelection = iota
+
+	// ReplicaLeastConnections uses the healthy read replica with the fewest connections in use.
+	ReplicaLeastConnections
+)
+
+const defaultReplicaDownTime = time.Minute
+
+type replica struct {
+	conn *SQLConnection
+
+	mtx       sync.Mutex
+	downUntil time.Time
+	backOff   *backoff.ExponentialBackOff
+}
+
+func newReplica(primary *SQLConnection, dsn string) (*replica, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	o := primary.options
+	o.replicaDSNs = nil
+	// Replicas are pinged by the supervisor of the primary.
+	o.supervisorInterval = 0
+
+	conn := &SQLConnection{
+		URL:     u,
+		L:       primary.L.WithField("replica", u.Host),
+		options: o,
+	}
+	if err := conn.parseDSNOptions(); err != nil {
+		return nil, err
+	}
+	if err := conn.checkTLSConfig(u); err != nil {
+		return nil, err
+	}
+
+	maxDownTime := primary.ReplicaDownTime
+	if maxDownTime <= 0 {
+		maxDownTime = defaultReplicaDownTime
+	}
+
+	backOff := backoff.NewExponentialBackOff()
+	if maxDownTime < backOff.InitialInterval {
+		backOff.InitialInterval = maxDownTime
+	}
+	backOff.MaxInterval = maxDownTime
+	backOff.MaxElapsedTime = 0
+	backOff.Reset()
+
+	return &replica{conn: conn, backOff: backOff}, nil
+}
+
+func (r *replica) isDown(now time.Time) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return now.Before(r.downUntil)
+}
+
+func (r *replica) markDown(err error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	d := r.backOff.NextBackOff()
+	r.downUntil = time.Now().Add(d)
+	r.conn.L.WithError(err).Warnf("Read replica is unhealthy, marking it as down for %s", d)
+}
+
+func (r *replica) markUp() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if !r.downUntil.IsZero() {
+		r.conn.L.Infof("Read replica is healthy again")
+	}
+	r.downUntil = time.Time{}
+	r.backOff.Reset()
+}
+
+func (r *replica) inUse() int {
+	r.conn.dbMtx.Lock()
+	db := r.conn.db
+	r.conn.dbMtx.Unlock()
+
+	if db == nil {
+		return 0
+	}
+	return db.Stats().InUse
+}
+
+// replicaCandidates returns all replicas which are not marked down, ordered by preference.
+func (c *SQLConnection) replicaCandidates() []*replica {
+	n := uint64(len(c.replicas))
+	if n == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	start := atomic.AddUint64(&c.rrCounter, 1) - 1
+	candidates := make([]*replica, 0, n)
+	for i := uint64(0); i < n; i++ {
+		if r := c.replicas[(start+i)%n]; !r.isDown(now) {
+			candidates = append(candidates, r)
+		}
+	}
+
+	if c.ReplicaSelection == ReplicaLeastConnections {
+		inUse := make(map[*replica]int, len(candidates))
+		for _, r := range candidates {
+			inUse[r] = r.inUse()
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return inUse[candidates[i]] < inUse[candidates[j]]
+		})
+	}
+
+	return candidates
+}
+
+// GetWriter returns the database instance of the primary. It is equivalent to GetDatabase.
+func (c *SQLConnection) GetWriter() (*sqlx.DB, error) {
+	return c.GetDatabaseContext(context.Background())
+}
+
+// GetWriterContext returns the database instance of the primary. It is equivalent to GetDatabaseContext.
+func (c *SQLConnection) GetWriterContext(ctx context.Context) (*sqlx.DB, error) {
+	return c.GetDatabaseContext(ctx)
+}
+
+// GetReader returns a database instance for read-only queries.
+func (c *SQLConnection) GetReader() (*sqlx.DB, error) {
+	return c.GetReaderContext(context.Background())
+}
+
+// GetReaderContext returns a database instance for read-only queries. It picks a healthy read replica using the
+// configured ReplicaSelection and falls back to the primary if there are no replicas or all of them are down.
+// A replica which can not be connected to is marked down.
+func (c *SQLConnection) GetReaderContext(ctx context.Context) (*sqlx.DB, error) {
+	for _, r := range c.replicaCandidates() {
+		db, err := r.conn.GetDatabaseContext(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, errors.WithStack(ctx.Err())
+			}
+			r.markDown(err)
+			continue
+		}
+		return db, nil
+	}
+
+	return c.GetDatabaseContext(ctx)
+}
+
+// PingReplicas pings all read replicas, marking the ones that fail as down and the ones that succeed as up again.
+// It returns the last error encountered, if any.
+func (c *SQLConnection) PingReplicas(ctx context.Context) error {
+	var lastErr error
+	for _, r := range c.replicas {
+		db, err := r.conn.GetDatabaseContext(ctx)
+		if err == nil {
+			err = errors.WithStack(db.PingContext(ctx))
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return errors.WithStack(ctx.Err())
+			}
+			r.markDown(err)
+			lastErr = err
+			continue
+		}
+		r.markUp()
+	}
+	return lastErr
+}
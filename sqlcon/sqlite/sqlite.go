@@ -0,0 +1,10 @@
+// Package sqlite registers the SQLite driver github.com/mattn/go-sqlite3 which is used by sqlcon for sqlite:// DSNs.
+// The driver requires cgo, so sqlcon does not import it and SQLite support has to be enabled explicitly:
+//
+//	import _ "github.com/open-identity/utils/sqlcon/sqlite"
+package sqlite
+
+import (
+	// Registers the "sqlite3" driver.
+	_ "github.com/mattn/go-sqlite3"
+)
@@ -0,0 +1,207 @@
+package sqlcon
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/InVisionApp/go-health"
+	"github.com/pkg/errors"
+)
+
+// ConnectionState is the state of a connection pool as observed by pinging the database, see WithSupervisor.
+type ConnectionState string
+
+const (
+	// StateDisconnected means that the connection pool has not been opened yet or has been closed.
+	StateDisconnected ConnectionState = "disconnected"
+	// StateConnected means that the last ping succeeded.
+	StateConnected ConnectionState = "connected"
+	// StateDegraded means that the last ping failed. Pinging continues and the state changes back to
+	// StateConnected once the database can be reached again.
+	StateDegraded ConnectionState = "degraded"
+)
+
+// defaultCheckTimeout is the ping timeout used by Status if no supervisor is running.
+const defaultCheckTimeout = time.Second * 5
+
+// WithSupervisor starts a supervisor goroutine once the connection pool has been opened. It pings the primary every
+// interval and changes the state of the connection between StateConnected and StateDegraded accordingly, see State.
+// When the database becomes unreachable, idle connections are closed so that connections to a failed over database
+// are established from scratch. The read replicas are pinged as well, see PingReplicas. The supervisor is stopped
+// by Close.
+func WithSupervisor(interval time.Duration) OptionModifier {
+	return func(o *options) {
+		o.supervisorInterval = interval
+	}
+}
+
+var _ health.ICheckable = (*SQLConnection)(nil)
+
+// connectionHealth is the state of a connection pool and its supervisor.
+type connectionHealth struct {
+	mtx   sync.Mutex
+	state ConnectionState
+	since time.Time
+	err   error
+
+	stop func()
+	done chan struct{}
+}
+
+// State returns the current state of the connection pool, the time it entered this state and, if it is degraded,
+// the error of the last ping.
+func (c *SQLConnection) State() (ConnectionState, time.Time, error) {
+	c.health.mtx.Lock()
+	defer c.health.mtx.Unlock()
+
+	if len(c.health.state) == 0 {
+		return StateDisconnected, c.health.since, nil
+	}
+	return c.health.state, c.health.since, c.health.err
+}
+
+// setState changes the state of the connection pool and logs the change.
+func (c *SQLConnection) setState(state ConnectionState, err error) (previous ConnectionState) {
+	c.health.mtx.Lock()
+	previous = c.health.state
+	if len(previous) == 0 {
+		previous = StateDisconnected
+	}
+	c.health.err = err
+	if previous != state {
+		c.health.state = state
+		c.health.since = time.Now()
+	}
+	c.health.mtx.Unlock()
+
+	if previous == state {
+		return previous
+	}
+
+	l := c.L.WithField("state", state).WithField("previous_state", previous)
+	if state == StateDegraded {
+		l.WithError(err).Warn("SQL connection is degraded")
+	} else {
+		l.Info("SQL connection state changed")
+	}
+	return previous
+}
+
+// check pings the database and updates the state of the connection pool. It does nothing if the pool has not been
+// opened or ctx is done.
+func (c *SQLConnection) check(ctx context.Context, timeout time.Duration) {
+	c.dbMtx.Lock()
+	db := c.db
+	c.dbMtx.Unlock()
+
+	if db == nil {
+		return
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, timeout)
+	err := db.PingContext(pingCtx)
+	cancel()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err != nil {
+		if c.setState(StateDegraded, errors.WithStack(err)) == StateConnected {
+			// Closes all idle connections, they most likely point to the failed database.
+			db.SetMaxIdleConns(0)
+			db.SetMaxIdleConns(c.dsnOptions.MaxIdleConns)
+		}
+		return
+	}
+	c.setState(StateConnected, nil)
+}
+
+// startSupervisor starts the supervisor goroutine unless it is disabled or running already.
+func (c *SQLConnection) startSupervisor() {
+	if c.supervisorInterval <= 0 {
+		return
+	}
+
+	c.health.mtx.Lock()
+	defer c.health.mtx.Unlock()
+
+	if c.health.stop != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	c.health.stop = cancel
+	c.health.done = done
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(c.supervisorInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.check(ctx, c.supervisorInterval)
+				if len(c.replicas) > 0 {
+					pingCtx, cancel := context.WithTimeout(ctx, c.supervisorInterval)
+					_ = c.PingReplicas(pingCtx)
+					cancel()
+				}
+			}
+		}
+	}()
+}
+
+// detachSupervisor marks the supervisor goroutine as stopped, so that startSupervisor starts a new one, and returns a
+// function which stops the detached goroutine, if it is running, and waits for it to return.
+func (c *SQLConnection) detachSupervisor() func() {
+	c.health.mtx.Lock()
+	stop, done := c.health.stop, c.health.done
+	c.health.stop, c.health.done = nil, nil
+	c.health.mtx.Unlock()
+
+	return func() {
+		if stop == nil {
+			return
+		}
+		stop()
+		<-done
+	}
+}
+
+// Status implements health.ICheckable. It fails unless the connection pool has been opened and the database could be
+// reached. If no supervisor is running, the database is pinged, otherwise the state observed by the supervisor is
+// reported, see WithSupervisor.
+func (c *SQLConnection) Status() (interface{}, error) {
+	if c.supervisorInterval <= 0 {
+		c.check(context.Background(), defaultCheckTimeout)
+	}
+
+	state, since, err := c.State()
+	details := map[string]interface{}{"state": state, "since": since}
+	switch state {
+	case StateConnected:
+		return details, nil
+	case StateDegraded:
+		return details, errors.Wrap(err, "database connection is degraded")
+	default:
+		return details, errors.New("database connection has not been established")
+	}
+}
+
+// RegisterHealthCheck adds the connection as a fatal check with the given name to h, so that the readiness reported
+// by h reflects the state of the database, see Status.
+func (c *SQLConnection) RegisterHealthCheck(h health.IHealth, name string, interval time.Duration) error {
+	return errors.WithStack(h.AddCheck(&health.Config{
+		Name:     name,
+		Checker:  c,
+		Interval: interval,
+		Fatal:    true,
+	}))
+}
@@ -0,0 +1,142 @@
+package sqlcon
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/InVisionApp/go-health"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func waitForState(t *testing.T, c *SQLConnection, expected ConnectionState) {
+	deadline := time.Now().Add(time.Second * 5)
+	for time.Now().Before(deadline) {
+		if state, _, _ := c.State(); state == expected {
+			return
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	state, _, err := c.State()
+	t.Fatalf("expected state %s but got %s (%v)", expected, state, err)
+}
+
+func TestSupervisor(t *testing.T) {
+	dsn, cleanup := tempSQLiteDSN(t)
+	defer cleanup()
+
+	l, hook := test.NewNullLogger()
+	var fail int32
+	c, err := NewSQLConnection(dsn, l,
+		WithSupervisor(time.Millisecond*10),
+		WithOnAcquire(func(ctx context.Context, conn Conn) error {
+			if atomic.LoadInt32(&fail) == 1 {
+				return errors.New("database is gone")
+			}
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+
+	state, _, _ := c.State()
+	assert.Equal(t, StateDisconnected, state)
+	_, err = c.Status()
+	require.Error(t, err)
+
+	_, err = c.GetDatabase()
+	require.NoError(t, err)
+	waitForState(t, c, StateConnected)
+	_, err = c.Status()
+	require.NoError(t, err)
+
+	atomic.StoreInt32(&fail, 1)
+	waitForState(t, c, StateDegraded)
+	_, err = c.Status()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "database is gone")
+
+	var degraded bool
+	for _, e := range hook.AllEntries() {
+		if e.Level == logrus.WarnLevel && e.Data["state"] == StateDegraded {
+			degraded = true
+		}
+	}
+	assert.True(t, degraded)
+
+	atomic.StoreInt32(&fail, 0)
+	waitForState(t, c, StateConnected)
+	assert.Equal(t, StateDegraded, hook.LastEntry().Data["previous_state"])
+
+	require.NoError(t, c.Close())
+	state, _, _ = c.State()
+	assert.Equal(t, StateDisconnected, state)
+}
+
+func TestSupervisorStopsWhenClosedWhileConnecting(t *testing.T) {
+	dsn, cleanup := tempSQLiteDSN(t)
+	defer cleanup()
+
+	l, _ := test.NewNullLogger()
+	c, err := NewSQLConnection(dsn, l, WithSupervisor(time.Millisecond*10))
+	require.NoError(t, err)
+
+	for i := 0; i < 50; i++ {
+		connected := make(chan error)
+		go func() {
+			_, err := c.GetDatabase()
+			connected <- err
+		}()
+		require.NoError(t, c.Close())
+		require.NoError(t, <-connected)
+
+		// Depending on whether Close took the pool, it has to be closed and unsupervised or open and supervised.
+		c.dbMtx.Lock()
+		open := c.db != nil
+		c.dbMtx.Unlock()
+		state, _, _ := c.State()
+		c.health.mtx.Lock()
+		supervised := c.health.stop != nil
+		c.health.mtx.Unlock()
+		if open {
+			assert.Equal(t, StateConnected, state)
+		} else {
+			assert.Equal(t, StateDisconnected, state)
+		}
+		assert.Equal(t, open, supervised)
+
+		require.NoError(t, c.Close())
+	}
+}
+
+func TestRegisterHealthCheck(t *testing.T) {
+	c, err := NewSQLConnection("sqlite://:memory:", nil)
+	require.NoError(t, err)
+	defer c.Close()
+
+	h := health.New()
+	h.DisableLogging()
+	require.NoError(t, c.RegisterHealthCheck(h, "database", time.Millisecond*10))
+	require.NoError(t, h.Start())
+	defer h.Stop()
+
+	time.Sleep(time.Millisecond * 50)
+	assert.True(t, h.Failed(), "the check fails until the database is connected")
+
+	_, err = c.GetDatabase()
+	require.NoError(t, err)
+
+	deadline := time.Now().Add(time.Second * 5)
+	for h.Failed() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 5)
+	}
+	assert.False(t, h.Failed())
+
+	states, _, err := h.State()
+	require.NoError(t, err)
+	assert.Equal(t, "ok", states["database"].Status)
+}
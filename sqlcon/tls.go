@@ -0,0 +1,306 @@
+package sqlcon
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+)
+
+// TLSConfig configures TLS for a connection, see WithTLSConfig.
+type TLSConfig struct {
+	// Mode defaults to TLSModeVerifyFull. TLSModeAllow and TLSModePrefer are not supported because neither driver
+	// is able to fall back to an unencrypted connection.
+	Mode TLSMode
+
+	// CAFile is the path of a PEM encoded CA bundle used to verify the server. Defaults to the system's
+	// certificate pool.
+	CAFile string
+
+	// CertFile and KeyFile are the paths of a PEM encoded client certificate and its key.
+	CertFile string
+	KeyFile  string
+
+	// ServerName is the name verified against the server certificate in TLSModeVerifyFull. Defaults to the host of
+	// the DSN. PostgreSQL always verifies the host of the DSN, so a different name is rejected.
+	ServerName string
+}
+
+// WithTLSConfig configures TLS for the connection. The settings are translated into sslmode, sslrootcert, sslcert
+// and sslkey for PostgreSQL and into a registered TLS config for MySQL. SQLite does not use TLS. Certificates are
+// read again whenever a new physical connection is established and the files have changed, so rotated
+// certificates are picked up without a restart.
+func WithTLSConfig(c TLSConfig) OptionModifier {
+	return func(o *options) {
+		o.tlsConfig = &c
+	}
+}
+
+// checkTLSConfig returns an error if the driver for the given URL is unable to honour the TLS config.
+func (c *SQLConnection) checkTLSConfig(u *url.URL) error {
+	if c.tlsConfig == nil || (u.Scheme != DriverPostgreSQL && u.Scheme != DriverMySQL) {
+		return nil
+	}
+
+	switch c.tlsConfig.Mode {
+	case "", TLSModeDisable, TLSModeRequire, TLSModeVerifyCA, TLSModeVerifyFull:
+	case TLSModeAllow, TLSModePrefer:
+		return errors.Errorf("TLS mode %s is not supported by %s because it can not fall back to an unencrypted connection", c.tlsConfig.Mode, u.Scheme)
+	default:
+		return errors.Errorf("unknown TLS mode %s", c.tlsConfig.Mode)
+	}
+
+	if u.Scheme == DriverPostgreSQL && len(c.tlsConfig.ServerName) > 0 && c.tlsConfig.ServerName != u.Hostname() {
+		return errors.Errorf("TLS server name %s is not supported by %s because it always verifies the host of the DSN", c.tlsConfig.ServerName, u.Scheme)
+	}
+	return nil
+}
+
+// applyTLS translates the TLS config into driver specific query parameters of the given (cleaned) URL.
+func (c *SQLConnection) applyTLS(clean *url.URL) error {
+	if c.tlsConfig == nil {
+		return nil
+	}
+	if err := c.checkTLSConfig(clean); err != nil {
+		return err
+	}
+
+	mode := c.tlsConfig.Mode
+	if len(mode) == 0 {
+		mode = TLSModeVerifyFull
+	}
+
+	q := clean.Query()
+	switch clean.Scheme {
+	case DriverPostgreSQL:
+		q.Set("sslmode", string(mode))
+		if len(c.tlsConfig.CAFile) > 0 {
+			q.Set("sslrootcert", c.tlsConfig.CAFile)
+		}
+		if len(c.tlsConfig.CertFile) > 0 {
+			q.Set("sslcert", c.tlsConfig.CertFile)
+			q.Set("sslkey", c.tlsConfig.KeyFile)
+		}
+	case DriverMySQL:
+		if mode == TLSModeDisable {
+			q.Set("tls", "false")
+			break
+		}
+
+		name, err := c.registerMySQLTLSConfig(mode, mysqlServerName(clean))
+		if err != nil {
+			return err
+		}
+		q.Set("tls", name)
+	default:
+		c.L.Warnf("TLS configuration is ignored because %s does not support TLS", clean.Scheme)
+	}
+
+	clean.RawQuery = q.Encode()
+	return nil
+}
+
+// registerMySQLTLSConfig registers the TLS config with the MySQL driver once per connection and returns its name.
+func (c *SQLConnection) registerMySQLTLSConfig(mode TLSMode, host string) (string, error) {
+	c.tlsMtx.Lock()
+	defer c.tlsMtx.Unlock()
+
+	if len(c.tlsName) > 0 {
+		return c.tlsName, nil
+	}
+
+	serverName := c.tlsConfig.ServerName
+	if len(serverName) == 0 {
+		serverName = host
+	}
+
+	r := newCertReloader(c.tlsConfig.CAFile, c.tlsConfig.CertFile, c.tlsConfig.KeyFile)
+	if err := r.reload(); err != nil {
+		return "", err
+	}
+
+	config := &tls.Config{
+		// The server certificate is verified by VerifyPeerCertificate so that the CA bundle can be reloaded.
+		InsecureSkipVerify:   true,
+		ServerName:           serverName,
+		GetClientCertificate: r.clientCertificate,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			switch mode {
+			case TLSModeVerifyCA:
+				return r.verify(rawCerts, "")
+			case TLSModeVerifyFull:
+				return r.verify(rawCerts, serverName)
+			}
+			return nil
+		},
+	}
+
+	name := "sqlcon-" + uuid.New()
+	if err := mysql.RegisterTLSConfig(name, config); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	c.tlsName = name
+	return name, nil
+}
+
+// deregisterMySQLTLSConfig removes the TLS config, which the MySQL driver keeps globally, once the connection is
+// closed. It is registered again when a new connection pool is opened.
+func (c *SQLConnection) deregisterMySQLTLSConfig() {
+	c.tlsMtx.Lock()
+	defer c.tlsMtx.Unlock()
+
+	if len(c.tlsName) > 0 {
+		mysql.DeregisterTLSConfig(c.tlsName)
+		c.tlsName = ""
+	}
+}
+
+// certReloader loads a CA bundle and a client certificate and reloads them once the files change.
+type certReloader struct {
+	caFile, certFile, keyFile string
+
+	mtx      sync.Mutex
+	loaded   bool
+	modTimes map[string]time.Time
+	pool     *x509.CertPool
+	cert     *tls.Certificate
+}
+
+func newCertReloader(caFile, certFile, keyFile string) *certReloader {
+	return &certReloader{caFile: caFile, certFile: certFile, keyFile: keyFile}
+}
+
+// currentModTimes returns the modification times of all configured files.
+func (r *certReloader) currentModTimes() (map[string]time.Time, error) {
+	modTimes := map[string]time.Time{}
+	for _, file := range []string{r.caFile, r.certFile, r.keyFile} {
+		if len(file) == 0 {
+			continue
+		}
+
+		fi, err := os.Stat(file)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		modTimes[file] = fi.ModTime()
+	}
+	return modTimes, nil
+}
+
+// reload loads the files unless they have been loaded before and not been modified since.
+func (r *certReloader) reload() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	modTimes, err := r.currentModTimes()
+	if err != nil {
+		return err
+	}
+
+	if r.loaded {
+		changed := false
+		for file, modTime := range modTimes {
+			if !modTime.Equal(r.modTimes[file]) {
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || len(r.caFile) > 0 {
+		pool = x509.NewCertPool()
+	}
+	if len(r.caFile) > 0 {
+		pem, err := ioutil.ReadFile(r.caFile)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.Errorf("unable to append certificates from CA file %s", r.caFile)
+		}
+	}
+
+	var cert *tls.Certificate
+	if len(r.certFile) > 0 {
+		c, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		cert = &c
+	}
+
+	r.pool = pool
+	r.cert = cert
+	r.modTimes = modTimes
+	r.loaded = true
+	return nil
+}
+
+func (r *certReloader) current() (*x509.CertPool, *tls.Certificate, error) {
+	if err := r.reload(); err != nil {
+		return nil, nil, err
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.pool, r.cert, nil
+}
+
+func (r *certReloader) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	_, cert, err := r.current()
+	if err != nil {
+		return nil, err
+	}
+	if cert == nil {
+		// An empty certificate tells the server that no client certificate is available.
+		return &tls.Certificate{}, nil
+	}
+	return cert, nil
+}
+
+// verify verifies the certificate chain presented by the server. If serverName is not empty, it must match the
+// server certificate as well.
+func (r *certReloader) verify(rawCerts [][]byte, serverName string) error {
+	pool, _, err := r.current()
+	if err != nil {
+		return err
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		if certs[i], err = x509.ParseCertificate(raw); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if len(certs) == 0 {
+		return errors.New("server did not present a certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	if host, _, err := net.SplitHostPort(serverName); err == nil {
+		serverName = host
+	}
+
+	_, err = certs[0].Verify(x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: intermediates,
+		DNSName:       serverName,
+	})
+	return errors.WithStack(err)
+}
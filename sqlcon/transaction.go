@@ -1,7 +1,13 @@
 package sqlcon
 
 import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cenkalti/backoff"
 	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
 )
 
 // A Txfn is a function that will be called with an initialized `Transaction` object
@@ -16,6 +22,12 @@ func WithTransaction(db *sqlx.DB, fn TxFn) (err error) {
 		return
 	}
 
+	return runTransaction(tx, func() error { return fn(tx) })
+}
+
+// runTransaction calls fn and commits the transaction if fn succeeds. The transaction is rolled back if fn returns an
+// error or panics, in which case the panic is propagated after the rollback.
+func runTransaction(tx *sqlx.Tx, fn func() error) (err error) {
 	defer func() {
 		if p := recover(); p != nil {
 			// a panic occurred, rollback and repanic
@@ -29,6 +41,98 @@ func WithTransaction(db *sqlx.DB, fn TxFn) (err error) {
 		}
 	}()
 
-	err = fn(tx)
+	err = fn()
 	return err
 }
+
+type txOptions struct {
+	isolation   sql.IsolationLevel
+	readOnly    bool
+	maxAttempts int
+	backOff     backoff.BackOff
+}
+
+// TxOption is a wrapper for the options of WithRetryingTransaction and WithTransactionContext.
+type TxOption func(*txOptions)
+
+// WithIsolationLevel sets the isolation level of the transaction. Defaults to the database's default.
+func WithIsolationLevel(level sql.IsolationLevel) TxOption {
+	return func(o *txOptions) {
+		o.isolation = level
+	}
+}
+
+// WithReadOnly makes the transaction read-only.
+func WithReadOnly() TxOption {
+	return func(o *txOptions) {
+		o.readOnly = true
+	}
+}
+
+// WithMaxAttempts sets how often the transaction is attempted at most. Defaults to 5 for WithRetryingTransaction
+// and to 1 for WithTransactionContext.
+func WithMaxAttempts(attempts int) TxOption {
+	return func(o *txOptions) {
+		o.maxAttempts = attempts
+	}
+}
+
+// WithBackOff sets the back off used to wait between attempts. Defaults to an exponential back off starting at 10ms.
+func WithBackOff(b backoff.BackOff) TxOption {
+	return func(o *txOptions) {
+		o.backOff = b
+	}
+}
+
+func newTxOptions(maxAttempts int, opts []TxOption) *txOptions {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = time.Millisecond * 10
+	b.MaxInterval = time.Second
+	b.MaxElapsedTime = 0
+
+	o := &txOptions{maxAttempts: maxAttempts, backOff: b}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.maxAttempts < 1 {
+		o.maxAttempts = 1
+	}
+	return o
+}
+
+// WithRetryingTransaction works like WithTransaction but starts the transaction with the configured isolation level
+// and read-only flag and runs it again if it fails with a retryable error (see IsRetryableError), for example because
+// it was aborted due to a serialization failure or deadlock. fn must therefore be safe to call more than once.
+//
+// Retrying stops as soon as ctx is done or the maximum number of attempts has been reached, in which case the last
+// error is returned.
+func WithRetryingTransaction(ctx context.Context, db *sqlx.DB, fn TxFn, opts ...TxOption) error {
+	return retryTransaction(ctx, db, newTxOptions(5, opts), func(_ context.Context, tx *sqlx.Tx) error {
+		return fn(tx)
+	})
+}
+
+func retryTransaction(ctx context.Context, db *sqlx.DB, o *txOptions, fn TxContextFn) error {
+	return backoff.Retry(func() error {
+		tx, err := db.BeginTxx(ctx, &sql.TxOptions{Isolation: o.isolation, ReadOnly: o.readOnly})
+		if err != nil {
+			return retryableOrPermanent(err)
+		}
+
+		txCtx := context.WithValue(ctx, txContextKey, &txState{tx: tx})
+		return retryableOrPermanent(runTransaction(tx, func() error { return fn(txCtx, tx) }))
+	}, backoff.WithContext(backoff.WithMaxRetries(o.backOff, uint64(o.maxAttempts-1)), ctx))
+}
+
+func retryableOrPermanent(err error) error {
+	if err == nil || IsRetryableError(err) {
+		return err
+	}
+	return backoff.Permanent(err)
+}
+
+// IsRetryableError returns true if the error indicates that the transaction was aborted because of a conflict with a
+// concurrent transaction and running it again may succeed, i.e. if it maps to ErrSerializationFailure.
+func IsRetryableError(err error) bool {
+	return err != nil && mapError(errors.Cause(err)) == ErrSerializationFailure
+}
@@ -0,0 +1,89 @@
+package sqlcon
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+type contextKey int
+
+const txContextKey contextKey = iota + 1
+
+// txState is the transaction stored in a context together with its savepoint nesting depth.
+type txState struct {
+	tx    *sqlx.Tx
+	depth int
+}
+
+// A TxContextFn is a function that will be called with a context carrying the active transaction and the
+// transaction itself.
+type TxContextFn func(ctx context.Context, tx *sqlx.Tx) error
+
+// TransactionFromContext returns the transaction stored in the context by WithTransactionContext, if any.
+func TransactionFromContext(ctx context.Context) (*sqlx.Tx, bool) {
+	s, ok := ctx.Value(txContextKey).(*txState)
+	if !ok {
+		return nil, false
+	}
+	return s.tx, true
+}
+
+// ExecutorFromContext returns the transaction stored in the context or db if there is none. Functions which are
+// called both inside and outside of transactions can use it to run their statements.
+func ExecutorFromContext(ctx context.Context, db *sqlx.DB) sqlx.ExtContext {
+	if tx, ok := TransactionFromContext(ctx); ok {
+		return tx
+	}
+	return db
+}
+
+// WithTransactionContext starts a transaction using ctx and calls fn with a context carrying it. The transaction is
+// committed if fn succeeds and rolled back if fn returns an error or panics, like WithTransaction.
+//
+// If ctx already carries a transaction, db and opts are ignored and a SAVEPOINT is created within that transaction
+// instead. The savepoint is released if fn succeeds and rolled back to otherwise, so an error in a nested call only
+// undoes its own statements while the outer transaction may continue.
+//
+// opts configure the isolation level, read-only flag and retries of the outermost transaction, see
+// WithRetryingTransaction. Unless WithMaxAttempts is given, the transaction is attempted only once.
+func WithTransactionContext(ctx context.Context, db *sqlx.DB, fn TxContextFn, opts ...TxOption) error {
+	s, ok := ctx.Value(txContextKey).(*txState)
+	if !ok {
+		return retryTransaction(ctx, db, newTxOptions(1, opts), fn)
+	}
+
+	nested := &txState{tx: s.tx, depth: s.depth + 1}
+	savepoint := fmt.Sprintf("sqlcon_savepoint_%d", nested.depth)
+	if _, err := s.tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return runSavepoint(ctx, s.tx, savepoint, func() error {
+		return fn(context.WithValue(ctx, txContextKey, nested), s.tx)
+	})
+}
+
+// runSavepoint calls fn and releases the savepoint if fn succeeds. If fn returns an error or panics, the transaction
+// is rolled back to the savepoint and the panic is propagated afterwards.
+func runSavepoint(ctx context.Context, tx *sqlx.Tx, savepoint string, fn func() error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			// a panic occurred, rollback and repanic
+			_, _ = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint)
+			panic(p)
+		} else if err != nil {
+			if _, rerr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint); rerr != nil {
+				err = errors.Wrapf(err, "unable to roll back to savepoint: %s", rerr)
+			}
+		} else {
+			_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint)
+			err = errors.WithStack(err)
+		}
+	}()
+
+	err = fn()
+	return err
+}
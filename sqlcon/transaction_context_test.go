@@ -0,0 +1,70 @@
+package sqlcon
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func insert(ctx context.Context, db *sqlx.DB, name string) error {
+	_, err := ExecutorFromContext(ctx, db).ExecContext(ctx, "INSERT INTO foo (name) VALUES (?)", name)
+	return err
+}
+
+func TestWithTransactionContext(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	_, ok := TransactionFromContext(ctx)
+	assert.False(t, ok)
+
+	require.NoError(t, WithTransactionContext(ctx, db, func(ctx context.Context, tx *sqlx.Tx) error {
+		actual, ok := TransactionFromContext(ctx)
+		require.True(t, ok)
+		assert.True(t, tx == actual)
+
+		require.NoError(t, insert(ctx, db, "outer"))
+
+		// A failing nested call only rolls back its own statements.
+		require.Error(t, WithTransactionContext(ctx, db, func(ctx context.Context, nested *sqlx.Tx) error {
+			assert.True(t, tx == nested)
+			require.NoError(t, insert(ctx, db, "inner-1"))
+			return errors.New("rollback")
+		}))
+
+		require.NoError(t, WithTransactionContext(ctx, db, func(ctx context.Context, _ *sqlx.Tx) error {
+			require.NoError(t, insert(ctx, db, "inner-2"))
+			return WithTransactionContext(ctx, db, func(ctx context.Context, _ *sqlx.Tx) error {
+				return insert(ctx, db, "inner-3")
+			})
+		}))
+
+		assert.Panics(t, func() {
+			_ = WithTransactionContext(ctx, db, func(ctx context.Context, _ *sqlx.Tx) error {
+				require.NoError(t, insert(ctx, db, "inner-4"))
+				panic("foo")
+			})
+		})
+		return nil
+	}))
+
+	var names []string
+	require.NoError(t, db.Select(&names, "SELECT name FROM foo ORDER BY id"))
+	assert.Equal(t, []string{"outer", "inner-2", "inner-3"}, names)
+
+	require.Error(t, WithTransactionContext(ctx, db, func(ctx context.Context, _ *sqlx.Tx) error {
+		require.NoError(t, insert(ctx, db, "rolled-back"))
+		return errors.New("rollback")
+	}))
+	assert.Equal(t, 3, count(t, db))
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.Error(t, WithTransactionContext(cancelled, db, func(ctx context.Context, _ *sqlx.Tx) error {
+		return nil
+	}))
+}
@@ -0,0 +1,101 @@
+package sqlcon
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/cenkalti/backoff"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDatabase(t *testing.T) *sqlx.DB {
+	c, err := NewSQLConnection("sqlite://:memory:", nil)
+	require.NoError(t, err)
+	db, err := c.GetDatabase()
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE foo (id INTEGER PRIMARY KEY, name TEXT NOT NULL UNIQUE)")
+	require.NoError(t, err)
+	return db
+}
+
+func count(t *testing.T, db *sqlx.DB) (n int) {
+	require.NoError(t, db.Get(&n, "SELECT COUNT(*) FROM foo"))
+	return n
+}
+
+func TestWithRetryingTransaction(t *testing.T) {
+	db := newTestDatabase(t)
+	noWait := WithBackOff(&backoff.ZeroBackOff{})
+
+	t.Run("case=retries serialization failures", func(t *testing.T) {
+		var attempts int
+		require.NoError(t, WithRetryingTransaction(context.Background(), db, func(tx *sqlx.Tx) error {
+			attempts++
+			if _, err := tx.Exec("INSERT INTO foo (name) VALUES (?)", "retried"); err != nil {
+				return err
+			}
+			if attempts < 3 {
+				return &pq.Error{Code: "40001"}
+			}
+			return nil
+		}, noWait, WithIsolationLevel(sql.LevelSerializable)))
+		assert.Equal(t, 3, attempts)
+		assert.Equal(t, 1, count(t, db))
+	})
+
+	t.Run("case=gives up after max attempts", func(t *testing.T) {
+		var attempts int
+		err := WithRetryingTransaction(context.Background(), db, func(tx *sqlx.Tx) error {
+			attempts++
+			return &mysql.MySQLError{Number: 1213}
+		}, noWait, WithMaxAttempts(2))
+		require.Error(t, err)
+		assert.Equal(t, 2, attempts)
+	})
+
+	t.Run("case=does not retry other errors", func(t *testing.T) {
+		var attempts int
+		err := WithRetryingTransaction(context.Background(), db, func(tx *sqlx.Tx) error {
+			attempts++
+			_, err := tx.Exec("INSERT INTO foo (name) VALUES (?)", "retried")
+			return err
+		}, noWait)
+		require.Error(t, err)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("case=rolls back and repanics", func(t *testing.T) {
+		assert.Panics(t, func() {
+			_ = WithRetryingTransaction(context.Background(), db, func(tx *sqlx.Tx) error {
+				_, err := tx.Exec("INSERT INTO foo (name) VALUES (?)", "panic")
+				require.NoError(t, err)
+				panic("foo")
+			}, noWait)
+		})
+		assert.Equal(t, 1, count(t, db))
+	})
+
+	t.Run("case=read only", func(t *testing.T) {
+		require.NoError(t, WithRetryingTransaction(context.Background(), db, func(tx *sqlx.Tx) error {
+			var n int
+			return tx.Get(&n, "SELECT COUNT(*) FROM foo")
+		}, WithReadOnly()))
+	})
+}
+
+func TestIsRetryableError(t *testing.T) {
+	assert.True(t, IsRetryableError(&pq.Error{Code: "40001"}))
+	assert.True(t, IsRetryableError(&pq.Error{Code: "40P01"}))
+	assert.False(t, IsRetryableError(&pq.Error{Code: "23505"}))
+	assert.True(t, IsRetryableError(&mysql.MySQLError{Number: 1213}))
+	assert.False(t, IsRetryableError(&mysql.MySQLError{Number: 1062}))
+	assert.True(t, IsRetryableError(errors.New("database is locked")))
+	assert.False(t, IsRetryableError(errors.New("foo")))
+	assert.False(t, IsRetryableError(nil))
+}
@@ -0,0 +1,118 @@
+package tracing
+
+import (
+	"github.com/open-identity/utils/dsnx"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+// NewRedactingTracer wraps t so that the secrets of all DSNs contained in the operation names, the string tags and
+// the string and error log fields of its spans are masked. This includes the queries, arguments and errors which
+// are recorded by the traced SQL drivers of sqlcon. If r is nil, dsnx.DefaultSensitiveParameters are redacted.
+func NewRedactingTracer(t opentracing.Tracer, r *dsnx.Redactor) opentracing.Tracer {
+	if r == nil {
+		r = dsnx.NewRedactor()
+	}
+	return &redactingTracer{Tracer: t, r: r}
+}
+
+type redactingTracer struct {
+	opentracing.Tracer
+	r *dsnx.Redactor
+}
+
+func (t *redactingTracer) StartSpan(operationName string, opts ...opentracing.StartSpanOption) opentracing.Span {
+	var o opentracing.StartSpanOptions
+	for _, opt := range opts {
+		opt.Apply(&o)
+	}
+
+	// Tags are applied in order, so the redacted tags replace the original ones.
+	tags := opentracing.Tags{}
+	for k, v := range o.Tags {
+		if s, ok := v.(string); ok {
+			tags[k] = t.r.RedactString(s)
+		}
+	}
+	if len(tags) > 0 {
+		opts = append(append([]opentracing.StartSpanOption{}, opts...), tags)
+	}
+
+	return &redactingSpan{Span: t.Tracer.StartSpan(t.r.RedactString(operationName), opts...), tracer: t}
+}
+
+type redactingSpan struct {
+	opentracing.Span
+	tracer *redactingTracer
+}
+
+func (s *redactingSpan) SetOperationName(operationName string) opentracing.Span {
+	s.Span.SetOperationName(s.tracer.r.RedactString(operationName))
+	return s
+}
+
+func (s *redactingSpan) SetTag(key string, value interface{}) opentracing.Span {
+	if v, ok := value.(string); ok {
+		value = s.tracer.r.RedactString(v)
+	}
+	s.Span.SetTag(key, value)
+	return s
+}
+
+func (s *redactingSpan) LogFields(fields ...log.Field) {
+	redacted := make([]log.Field, len(fields))
+	for i, f := range fields {
+		switch v := f.Value().(type) {
+		case string:
+			redacted[i] = log.String(f.Key(), s.tracer.r.RedactString(v))
+		case error:
+			redacted[i] = log.String(f.Key(), s.tracer.r.RedactString(v.Error()))
+		default:
+			redacted[i] = f
+		}
+	}
+	s.Span.LogFields(redacted...)
+}
+
+func (s *redactingSpan) LogKV(alternatingKeyValues ...interface{}) {
+	fields, err := log.InterleavedKVToFields(alternatingKeyValues...)
+	if err != nil {
+		s.LogFields(log.Error(err), log.String("function", "LogKV"))
+		return
+	}
+	s.LogFields(fields...)
+}
+
+func (s *redactingSpan) SetBaggageItem(restrictedKey, value string) opentracing.Span {
+	s.Span.SetBaggageItem(restrictedKey, s.tracer.r.RedactString(value))
+	return s
+}
+
+func (s *redactingSpan) Tracer() opentracing.Tracer {
+	return s.tracer
+}
+
+func (s *redactingSpan) LogEvent(event string) {
+	s.LogFields(log.String("event", event))
+}
+
+func (s *redactingSpan) LogEventWithPayload(event string, payload interface{}) {
+	s.LogFields(log.String("event", event), log.Object("payload", s.redactPayload(payload)))
+}
+
+func (s *redactingSpan) Log(data opentracing.LogData) {
+	data.Event = s.tracer.r.RedactString(data.Event)
+	data.Payload = s.redactPayload(data.Payload)
+	s.Span.Log(data)
+}
+
+func (s *redactingSpan) redactPayload(payload interface{}) interface{} {
+	switch v := payload.(type) {
+	case string:
+		return s.tracer.r.RedactString(v)
+	case error:
+		return s.tracer.r.RedactString(v.Error())
+	default:
+		return payload
+	}
+}
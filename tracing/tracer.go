@@ -4,6 +4,7 @@ import (
 	"io"
 	"strings"
 
+	"github.com/open-identity/utils/dsnx"
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -17,6 +18,10 @@ type Tracer struct {
 	Logger       logrus.FieldLogger
 	JaegerConfig *JaegerConfig
 
+	// Redactor masks the DSNs contained in spans, see NewRedactingTracer. If nil, dsnx.DefaultSensitiveParameters
+	// are redacted.
+	Redactor *dsnx.Redactor
+
 	tracer opentracing.Tracer
 	closer io.Closer
 }
@@ -29,7 +34,7 @@ type JaegerConfig struct {
 	SamplerServerURL   string
 }
 
-// Setup sets up the tracer. Currently supports jaeger.
+// Setup sets up the tracer and registers it as the global tracer. Currently supports jaeger.
 func (t *Tracer) Setup() error {
 	switch strings.ToLower(t.Provider) {
 	case "jaeger":
@@ -53,7 +58,8 @@ func (t *Tracer) Setup() error {
 		}
 
 		t.closer = closer
-		t.tracer = opentracing.GlobalTracer()
+		t.tracer = NewRedactingTracer(opentracing.GlobalTracer(), t.Redactor)
+		opentracing.SetGlobalTracer(t.tracer)
 		t.Logger.Infof("Jaeger tracer configured!")
 	case "":
 		t.Logger.Infof("No tracer configured - skipping tracing setup")